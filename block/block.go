@@ -3,7 +3,6 @@ package block
 import (
 	"bytes"
 	"encoding/binary"
-	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
 	"time"
@@ -11,6 +10,7 @@ import (
 	"github.com/conformal/fastsha256"
 	trans "github.com/spx/gitchain/transaction"
 	"github.com/spx/gitchain/types"
+	"github.com/spx/gitchain/wire"
 	"github.com/xsleonard/go-merkle"
 )
 
@@ -36,10 +36,6 @@ type Block struct {
 	Transactions      []*trans.Envelope
 }
 
-func init() {
-	gob.Register(&Block{})
-}
-
 func (b *Block) Hash() types.Hash {
 	buf := bytes.NewBuffer([]byte{})
 	buf.Grow(192)
@@ -103,21 +99,50 @@ func NewBlock(previousBlockHash types.Hash, bits uint32, transactions []*trans.E
 }
 
 func (b *Block) Encode() ([]byte, error) {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	err := enc.Encode(&b)
-	return buf.Bytes(), err
+	enc := wire.NewEncoder()
+	enc.PutUint32(b.Version)
+	enc.PutBytes(b.PreviousBlockHash)
+	enc.PutBytes(b.MerkleRootHash)
+	enc.PutInt64(b.Timestamp)
+	enc.PutUint32(b.Bits)
+	enc.PutUint32(b.Nonce)
+	enc.PutCount(len(b.Transactions))
+	for i := range b.Transactions {
+		t, err := b.Transactions[i].Encode()
+		if err != nil {
+			return nil, err
+		}
+		enc.PutBytes(t)
+	}
+	return enc.Bytes(), nil
 }
 
 func Decode(encoded []byte) (*Block, error) {
-	var blk Block
-	buf := bytes.NewBuffer(encoded)
-	enc := gob.NewDecoder(buf)
-	err := enc.Decode(&blk)
-	if blk.Transactions == nil {
-		blk.Transactions = []*trans.Envelope{}
+	dec := wire.NewDecoder(encoded)
+	blk := &Block{
+		Version:           dec.Uint32(),
+		PreviousBlockHash: dec.Bytes(),
+		MerkleRootHash:    dec.Bytes(),
+		Timestamp:         dec.Int64(),
+		Bits:              dec.Uint32(),
+		Nonce:             dec.Uint32(),
+		Transactions:      []*trans.Envelope{}}
+	n := dec.Count()
+	encodedTransactions := make([][]byte, 0, n)
+	for i := 0; i < n; i++ {
+		encodedTransactions = append(encodedTransactions, dec.Bytes())
+	}
+	if err := dec.Finish(); err != nil {
+		return nil, err
+	}
+	for i := range encodedTransactions {
+		txe, err := trans.DecodeEnvelope(encodedTransactions[i])
+		if err != nil {
+			return nil, err
+		}
+		blk.Transactions = append(blk.Transactions, txe)
 	}
-	return &blk, err
+	return blk, nil
 }
 
 func (b *Block) String() string {
@@ -2,11 +2,13 @@ package block
 
 import (
 	"crypto/ecdsa"
+	"encoding/hex"
 	"testing"
 
 	"github.com/spx/gitchain/keys"
 	trans "github.com/spx/gitchain/transaction"
 	"github.com/spx/gitchain/types"
+	"github.com/spx/gitchain/util"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -116,6 +118,39 @@ func TestEncodeDecodeEmptyBlock(t *testing.T) {
 	assert.Equal(t, block, block1, "encoded and decoded block should be identical to the original one")
 }
 
+// the encoding and hash of blocks are part of the consensus rules, this
+// vector must never change
+func TestBlockGoldenVector(t *testing.T) {
+	pub, _ := hex.DecodeString("0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")
+	txe := &trans.Envelope{
+		PreviousEnvelopeHash: types.EmptyHash(),
+		SignatureR:           []byte{1},
+		SignatureS:           []byte{2},
+		PublicKey:            pub,
+		NextPublicKey:        pub,
+		Transaction: &trans.ReferenceUpdate{Version: 1, Repository: "repo", Ref: "refs/heads/master",
+			Old: util.SHA160([]byte("old")), New: util.SHA160([]byte("new"))}}
+	block := &Block{
+		Version:           1,
+		PreviousBlockHash: types.EmptyHash(),
+		MerkleRootHash:    util.SHA256([]byte("merkle")),
+		Timestamp:         1400000000,
+		Bits:              HIGHEST_TARGET,
+		Nonce:             42,
+		Transactions:      []*trans.Envelope{txe}}
+
+	enc, err := block.Encode()
+	assert.Nil(t, err)
+	assert.Equal(t, hex.EncodeToString(enc), "00000001000000200000000000000000000000000000000000000000000000000000000000000000000000207975edd9e7393c229e744913fe0d0bb86fb4cf46906e2e51152137e20ad155900000000053724e001d00ffff0000002a000000010000010f0100000020000000000000000000000000000000000000000000000000000000000000000000000001010000000102000000410479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8000000410479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8000000520500000001000000047265706f00000011726566732f68656164732f6d617374657200000014c00dbbc9dadfbe1e232e93a729dd4752fade0abf00000014c2a6b03f190dfb2b4aa91f8af8d477a9bc3401dc")
+	assert.Equal(t, hex.EncodeToString(block.Hash()), "6fcff103ba60d065b90a3cb9496cad665b4de11a0db159aadacbcd494ebc11f2")
+
+	block1, err := Decode(enc)
+	assert.Nil(t, err)
+	assert.Equal(t, block1, block)
+	_, err = Decode(append(enc, 0))
+	assert.NotNil(t, err)
+}
+
 func TestTargetFromBits(t *testing.T) {
 	// 0x0404cb * 2 * *(8 * (0x1b - 3)) = 0x00000000000404CB000000000000000000000000000000000000000000000000
 	b := targetFromBits(0x1b0404cb).Bytes()
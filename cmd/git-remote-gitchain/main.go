@@ -0,0 +1,84 @@
+// git-remote-gitchain lets git clone, fetch from and push to
+// gitchain://<repository> URLs. The repository is looked up through the
+// local gitchain daemon and the transfer is then handed over to git's own
+// smart HTTP helper, talking to the daemon's git endpoints.
+//
+// The daemon's configuration file, if any, can be set with
+//
+//	git config --global gitchain.config /path/to/gitchain.cfg
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/gorilla/rpc/json"
+	"github.com/spx/gitchain/server/api"
+	"github.com/spx/gitchain/server/config"
+)
+
+func jsonrpc(cfg *config.T, method string, req, res interface{}) error {
+	buf, err := json.EncodeClientRequest(method, req)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(fmt.Sprintf("http://localhost:%d/rpc", cfg.API.HttpPort), "application/json", bytes.NewBuffer(buf))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.DecodeClientResponse(resp.Body, res)
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "fatal: "+format+"\n", args...)
+	os.Exit(128)
+}
+
+// repositoryName extracts the repository name from the URL git passes
+// (gitchain://<repository>, or just <repository> for gitchain::<repository>)
+func repositoryName(url string) string {
+	return strings.Trim(strings.TrimPrefix(url, "gitchain://"), "/")
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		fail("usage: git-remote-gitchain <remote> gitchain://<repository>")
+	}
+	remote, name := os.Args[1], repositoryName(os.Args[2])
+	if name == "" {
+		fail("no repository name in %s", os.Args[2])
+	}
+
+	cfg := config.Default()
+	if out, err := exec.Command("git", "config", "--get", "gitchain.config").Output(); err == nil {
+		file := strings.TrimSpace(string(out))
+		if err = config.ReadFile(file, cfg); err != nil {
+			fail("can't read gitchain configuration %s: %v", file, err)
+		}
+	}
+
+	var reply api.GetRepositoryReply
+	if err := jsonrpc(cfg, "RepositoryService.GetRepository", &api.GetRepositoryArgs{Name: name}, &reply); err != nil {
+		fail("can't reach the gitchain daemon on port %d: %v", cfg.API.HttpPort, err)
+	}
+	switch {
+	case reply.Repository == nil:
+		fail("repository name %s hasn't been allocated on gitchain", name)
+	case reply.Repository.Status != "active":
+		fail("repository name %s is still pending (allocation %s isn't confirmed yet)", name, reply.Repository.NameAllocationTx)
+	}
+
+	helper := exec.Command("git", "remote-http", remote, fmt.Sprintf("http://localhost:%d/%s", cfg.API.HttpPort, name))
+	helper.Stdin, helper.Stdout, helper.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := helper.Run(); err != nil {
+		if exit, ok := err.(*exec.ExitError); ok && !exit.Success() {
+			os.Exit(1)
+		}
+		fail("can't run git remote-http: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"encoding/binary"
 	"errors"
 
 	"github.com/boltdb/bolt"
@@ -27,6 +28,17 @@ func (db *T) PutBlock(b *block.Block, last bool) (e error) {
 		if e != nil {
 			return false
 		}
+		// store its height, counted from the earliest known block
+		var height uint64
+		if previous := bucket.Get(append([]byte("h"), b.PreviousBlockHash...)); len(previous) == 8 {
+			height = binary.BigEndian.Uint64(previous) + 1
+		}
+		var encodedHeight [8]byte
+		binary.BigEndian.PutUint64(encodedHeight[:], height)
+		e = bucket.Put(append([]byte("h"), b.Hash()...), encodedHeight[:])
+		if e != nil {
+			return false
+		}
 
 		for i := range b.Transactions {
 			// transaction -> block mapping
@@ -40,12 +52,12 @@ func (db *T) PutBlock(b *block.Block, last bool) (e error) {
 				return false
 			}
 			// update "unspendable key"
-			e = bucket.Delete(append([]byte("<"), b.Transactions[i].PublicKey...))
+			e = bucket.Delete(append([]byte("<"), normalizedPublicKey(b.Transactions[i].PublicKey)...))
 			if e != nil {
 				return false
 			}
 			// update "spendable key", has to happen after updating the "unspendable" one as it might be the same one
-			e = bucket.Put(append([]byte("<"), b.Transactions[i].NextPublicKey...), b.Transactions[i].Hash())
+			e = bucket.Put(append([]byte("<"), normalizedPublicKey(b.Transactions[i].NextPublicKey)...), b.Transactions[i].Hash())
 			if e != nil {
 				return false
 			}
@@ -118,3 +130,21 @@ func (db *T) GetNextBlock(hash types.Hash) (blk *block.Block, e error) {
 	})
 	return
 }
+
+// GetBlockHeight returns the number of blocks preceding a block
+func (db *T) GetBlockHeight(hash types.Hash) (height int, e error) {
+	readable(&e, db, func(dbtx *bolt.Tx) {
+		bucket := dbtx.Bucket([]byte("blocks"))
+		if bucket == nil {
+			e = errors.New("blocks bucket does not exist")
+			return
+		}
+		b := bucket.Get(append([]byte("h"), hash...))
+		if len(b) != 8 {
+			e = errors.New("block not found")
+			return
+		}
+		height = int(binary.BigEndian.Uint64(b))
+	})
+	return
+}
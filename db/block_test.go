@@ -112,3 +112,39 @@ func TestGetNextBlock(t *testing.T) {
 	}
 	assert.True(t, nil == block0)
 }
+
+func TestGetBlockHeight(t *testing.T) {
+	transactions, _ := fixtureSampleTransactions(t)
+
+	blk, err := block.NewBlock(types.EmptyHash(), block.HIGHEST_TARGET, transactions)
+	if err != nil {
+		t.Errorf("can't create a block because of %v", err)
+	}
+
+	blk1, err := block.NewBlock(blk.Hash(), block.HIGHEST_TARGET, []*transaction.Envelope{})
+	if err != nil {
+		t.Errorf("can't create a block because of %v", err)
+	}
+
+	db, err := NewDB("test.db")
+	defer os.Remove("test.db")
+
+	if err != nil {
+		t.Errorf("error opening database: %v", err)
+	}
+
+	_, err = db.GetBlockHeight(blk.Hash())
+	assert.NotNil(t, err)
+
+	for _, b := range []*block.Block{blk, blk1} {
+		if err = db.PutBlock(b, false); err != nil {
+			t.Errorf("error putting block: %v", err)
+		}
+	}
+	height, err := db.GetBlockHeight(blk.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, height, 0)
+	height, err = db.GetBlockHeight(blk1.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, height, 1)
+}
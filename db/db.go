@@ -1,9 +1,18 @@
 package db
 
 import (
+	"fmt"
+
 	"github.com/boltdb/bolt"
 )
 
+// FORMAT is the version of the encoding of the data stored in a database:
+//
+//	1  gob encoded blocks and transactions
+//	2  canonically encoded blocks and transactions, public keys indexed in
+//	   their compressed encoding
+const FORMAT = 2
+
 type T struct {
 	Path string
 	DB   *bolt.DB
@@ -11,7 +20,33 @@ type T struct {
 
 func NewDB(path string) (*T, error) {
 	db, err := bolt.Open(path, 0666)
-	return &T{Path: path, DB: db}, err
+	if err != nil {
+		return &T{Path: path, DB: db}, err
+	}
+	t := &T{Path: path, DB: db}
+	return t, t.checkFormat()
+}
+
+// checkFormat records the format of a new database, making sure an
+// existing one can be read
+func (db *T) checkFormat() (e error) {
+	writable(&e, db, func(dbtx *bolt.Tx) bool {
+		var bucket *bolt.Bucket
+		if bucket, e = dbtx.CreateBucketIfNotExists([]byte("meta")); e != nil {
+			return false
+		}
+		format := bucket.Get([]byte("format"))
+		switch {
+		case format == nil && (dbtx.Bucket([]byte("blocks")) != nil || dbtx.Bucket([]byte("transactions")) != nil):
+			e = fmt.Errorf("%s holds gob encoded blocks and transactions, which can't be read anymore; start over with an empty data directory", db.Path)
+		case format == nil:
+			e = bucket.Put([]byte("format"), []byte{FORMAT})
+		case len(format) != 1 || format[0] != FORMAT:
+			e = fmt.Errorf("%s has an unsupported format %x", db.Path, format)
+		}
+		return e == nil
+	})
+	return
 }
 
 func writable(e *error, db *T, f func(*bolt.Tx) bool) error {
@@ -46,3 +81,12 @@ func readable(e *error, db *T, f func(*bolt.Tx)) error {
 	}
 	return err
 }
+
+// copyValue copies a value read from a bucket, which is only valid
+// until the transaction it was read in ends
+func copyValue(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
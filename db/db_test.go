@@ -53,6 +53,81 @@ func TestWritableReadable(t *testing.T) {
 
 }
 
+func TestCopyValue(t *testing.T) {
+	assert.Nil(t, copyValue(nil))
+	assert.Equal(t, copyValue([]byte{}), []byte{})
+	b := []byte{1, 2, 3}
+	c := copyValue(b)
+	b[0] = 0
+	assert.Equal(t, c, []byte{1, 2, 3})
+
+	var e error
+	db, err := NewDB("test.db")
+	defer os.Remove("test.db")
+	if err != nil {
+		t.Errorf("error opening database: %v", err)
+	}
+	writable(&e, db, func(dbtx *bolt.Tx) bool {
+		bucket, _ := dbtx.CreateBucketIfNotExists([]byte("test"))
+		e = bucket.Put([]byte{0}, []byte{1})
+		if e == nil {
+			e = bucket.Put([]byte{1}, []byte{})
+		}
+		return e == nil
+	})
+	assert.Nil(t, e)
+
+	var value, empty, missing []byte
+	readable(&e, db, func(dbtx *bolt.Tx) {
+		bucket := dbtx.Bucket([]byte("test"))
+		value = copyValue(bucket.Get([]byte{0}))
+		empty = copyValue(bucket.Get([]byte{1}))
+		missing = copyValue(bucket.Get([]byte{2}))
+	})
+	// values stay readable once the database has grown
+	writable(&e, db, func(dbtx *bolt.Tx) bool {
+		bucket, _ := dbtx.CreateBucketIfNotExists([]byte("test"))
+		for i := 0; i < 1000 && e == nil; i++ {
+			e = bucket.Put([]byte{3, byte(i >> 8), byte(i)}, make([]byte, 1024))
+		}
+		return e == nil
+	})
+	assert.Nil(t, e)
+	assert.Equal(t, value, []byte{1})
+	assert.NotNil(t, empty)
+	assert.Equal(t, len(empty), 0)
+	assert.Nil(t, missing)
+	db.DB.Close()
+}
+
+func TestFormat(t *testing.T) {
+	var e error
+	db, err := NewDB("test.db")
+	defer os.Remove("test.db")
+
+	if err != nil {
+		t.Errorf("error opening database: %v", err)
+	}
+	db.DB.Close()
+	// reopening a database of the current format
+	db, err = NewDB("test.db")
+	assert.Nil(t, err)
+
+	// a database written before formats were recorded
+	writable(&e, db, func(dbtx *bolt.Tx) bool {
+		if e = dbtx.DeleteBucket([]byte("meta")); e != nil {
+			return false
+		}
+		_, e = dbtx.CreateBucketIfNotExists([]byte("blocks"))
+		return e == nil
+	})
+	assert.Nil(t, e)
+	db.DB.Close()
+	db, err = NewDB("test.db")
+	assert.NotNil(t, err)
+	db.DB.Close()
+}
+
 func fixtureSampleTransactions(t *testing.T) ([]*transaction.Envelope, *ecdsa.PrivateKey) {
 	privateKey := generateECDSAKey(t)
 	txn1, rand := transaction.NewNameReservation("my-new-repository")
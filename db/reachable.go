@@ -0,0 +1,49 @@
+package db
+
+import (
+	"github.com/boltdb/bolt"
+)
+
+// AddReachableObjects records objects as reachable from the references of
+// a repository
+func (db *T) AddReachableObjects(name string, hashes [][]byte) (e error) {
+	writable(&e, db, func(dbtx *bolt.Tx) bool {
+		var bucket *bolt.Bucket
+		if bucket, e = dbtx.CreateBucketIfNotExists(append([]byte("reachable"), []byte(name)...)); e != nil {
+			return false
+		}
+		for i := range hashes {
+			if e = bucket.Put(hashes[i], []byte{}); e != nil {
+				return false
+			}
+		}
+		return true
+	})
+	return
+}
+
+// IsReachableObject tells whether an object has been recorded as
+// reachable from the references of a repository
+func (db *T) IsReachableObject(name string, hash []byte) (reachable bool, e error) {
+	readable(&e, db, func(dbtx *bolt.Tx) {
+		bucket := dbtx.Bucket(append([]byte("reachable"), []byte(name)...))
+		if bucket == nil {
+			return // return no error because nothing was recorded
+		}
+		reachable = bucket.Get(hash) != nil
+	})
+	return
+}
+
+// RemoveReachableObjects forgets the objects recorded as reachable from the
+// references of a repository
+func (db *T) RemoveReachableObjects(name string) (e error) {
+	writable(&e, db, func(dbtx *bolt.Tx) bool {
+		if dbtx.Bucket(append([]byte("reachable"), []byte(name)...)) == nil {
+			return true
+		}
+		e = dbtx.DeleteBucket(append([]byte("reachable"), []byte(name)...))
+		return e == nil
+	})
+	return
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spx/gitchain/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReachableObjects(t *testing.T) {
+	db, err := NewDB("test.db")
+	defer os.Remove("test.db")
+
+	if err != nil {
+		t.Errorf("error opening database: %v", err)
+	}
+
+	obj, obj1 := util.SHA160([]byte("object")), util.SHA160([]byte("another object"))
+	reachable, err := db.IsReachableObject("myrepo", obj)
+	assert.Nil(t, err)
+	assert.False(t, reachable)
+
+	err = db.AddReachableObjects("myrepo", [][]byte{obj})
+	if err != nil {
+		t.Errorf("error adding reachable objects: %v", err)
+	}
+	reachable, err = db.IsReachableObject("myrepo", obj)
+	assert.Nil(t, err)
+	assert.True(t, reachable)
+	reachable, err = db.IsReachableObject("myrepo", obj1)
+	assert.Nil(t, err)
+	assert.False(t, reachable)
+	// objects are recorded per repository
+	reachable, err = db.IsReachableObject("another", obj)
+	assert.Nil(t, err)
+	assert.False(t, reachable)
+}
+
+func TestRemoveReachableObjects(t *testing.T) {
+	db, err := NewDB("test.db")
+	defer os.Remove("test.db")
+
+	if err != nil {
+		t.Errorf("error opening database: %v", err)
+	}
+
+	obj := util.SHA160([]byte("object"))
+	assert.Nil(t, db.RemoveReachableObjects("myrepo"))
+	assert.Nil(t, db.AddReachableObjects("myrepo", [][]byte{obj}))
+	assert.Nil(t, db.AddReachableObjects("another", [][]byte{obj}))
+	assert.Nil(t, db.RemoveReachableObjects("myrepo"))
+	reachable, err := db.IsReachableObject("myrepo", obj)
+	assert.Nil(t, err)
+	assert.False(t, reachable)
+	reachable, err = db.IsReachableObject("another", obj)
+	assert.Nil(t, err)
+	assert.True(t, reachable)
+}
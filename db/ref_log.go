@@ -0,0 +1,76 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/boltdb/bolt"
+	"github.com/spx/gitchain/repository"
+)
+
+// entries of a reference are keyed by the reference name, a NUL byte and
+// their position in its log
+func refLogKey(ref string, n uint64) []byte {
+	key := append([]byte(ref), 0)
+	var pos [8]byte
+	binary.BigEndian.PutUint64(pos[:], n)
+	return append(key, pos[:]...)
+}
+
+// the number of entries of a reference is keyed by a NUL byte and the
+// reference name, which no entry key starts with
+func refLogCountKey(ref string) []byte {
+	return append([]byte{0}, ref...)
+}
+
+// AddRefLogEntries appends entries to the logs of the references of a
+// repository
+func (db *T) AddRefLogEntries(name string, entries []*repository.RefLogEntry) (e error) {
+	writable(&e, db, func(dbtx *bolt.Tx) bool {
+		var bucket *bolt.Bucket
+		if bucket, e = dbtx.CreateBucketIfNotExists(append([]byte("ref_log"), []byte(name)...)); e != nil {
+			return false
+		}
+		for i := range entries {
+			var n uint64
+			if count := bucket.Get(refLogCountKey(entries[i].Ref)); len(count) == 8 {
+				n = binary.BigEndian.Uint64(count)
+			}
+			var encoded []byte
+			if encoded, e = entries[i].Encode(); e != nil {
+				return false
+			}
+			if e = bucket.Put(refLogKey(entries[i].Ref, n), encoded); e != nil {
+				return false
+			}
+			var count [8]byte
+			binary.BigEndian.PutUint64(count[:], n+1)
+			if e = bucket.Put(refLogCountKey(entries[i].Ref), count[:]); e != nil {
+				return false
+			}
+		}
+		return true
+	})
+	return
+}
+
+// GetRefLog returns the log of a reference, oldest entries first
+func (db *T) GetRefLog(name, ref string) (entries []*repository.RefLogEntry, e error) {
+	readable(&e, db, func(dbtx *bolt.Tx) {
+		bucket := dbtx.Bucket(append([]byte("ref_log"), []byte(name)...))
+		if bucket == nil {
+			return // return no error because no references were updated
+		}
+		prefix := append([]byte(ref), 0)
+		c := bucket.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			entry, err := repository.DecodeRefLogEntry(v)
+			if err != nil {
+				e = err
+				return
+			}
+			entries = append(entries, entry)
+		}
+	})
+	return
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spx/gitchain/repository"
+	"github.com/spx/gitchain/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddGetRefLog(t *testing.T) {
+	db, err := NewDB("test.db")
+	defer os.Remove("test.db")
+
+	if err != nil {
+		t.Errorf("error opening database: %v", err)
+	}
+
+	entries, err := db.GetRefLog("repo", "refs/heads/master")
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+
+	first := util.SHA160([]byte("first"))
+	second := util.SHA160([]byte("second"))
+	err = db.AddRefLogEntries("repo", []*repository.RefLogEntry{
+		{Ref: "refs/heads/master", Old: repository.EmptyRef(), New: first, Transaction: util.SHA256([]byte("tx1")), Height: 1},
+		{Ref: "refs/heads/master2", Old: repository.EmptyRef(), New: first, Transaction: util.SHA256([]byte("tx1")), Height: 1}})
+	if err != nil {
+		t.Errorf("error adding reference log entries: %v", err)
+	}
+	err = db.AddRefLogEntries("repo", []*repository.RefLogEntry{
+		{Ref: "refs/heads/master", Old: first, New: second, Transaction: util.SHA256([]byte("tx2")), Height: 2}})
+	if err != nil {
+		t.Errorf("error adding reference log entries: %v", err)
+	}
+
+	entries, err = db.GetRefLog("repo", "refs/heads/master")
+	if err != nil {
+		t.Errorf("error getting reference log: %v", err)
+	}
+	if assert.Equal(t, len(entries), 2) {
+		assert.Equal(t, []byte(entries[0].New), first)
+		assert.Equal(t, entries[0].Height, 1)
+		assert.Equal(t, []byte(entries[1].Old), first)
+		assert.Equal(t, []byte(entries[1].New), second)
+		assert.Equal(t, []byte(entries[1].Transaction), util.SHA256([]byte("tx2")))
+	}
+	entries, err = db.GetRefLog("repo", "refs/heads/master2")
+	assert.Nil(t, err)
+	assert.Equal(t, len(entries), 1)
+
+	entries, err = db.GetRefLog("another", "refs/heads/master")
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/spx/gitchain/types"
+)
+
+// PutRefUpdateStatus records the outcome of a (batch) reference update
+// transaction once it has been confirmed, repository.REF_UPDATE_APPLIED
+// or the reason why it was rejected
+func (db *T) PutRefUpdateStatus(hash types.Hash, status string) (e error) {
+	writable(&e, db, func(dbtx *bolt.Tx) bool {
+		var bucket *bolt.Bucket
+		if bucket, e = dbtx.CreateBucketIfNotExists([]byte("ref_updates")); e != nil {
+			return false
+		}
+		e = bucket.Put(hash, []byte(status))
+		return e == nil
+	})
+	return
+}
+
+// GetRefUpdateStatus returns the outcome of a reference update
+// transaction, or an empty string if it hasn't been processed yet
+func (db *T) GetRefUpdateStatus(hash types.Hash) (status string, e error) {
+	readable(&e, db, func(dbtx *bolt.Tx) {
+		bucket := dbtx.Bucket([]byte("ref_updates"))
+		if bucket == nil {
+			return // return no error because no updates were processed
+		}
+		status = string(bucket.Get(hash))
+	})
+	return
+}
+
+// PutRefTransaction records the (batch) reference update transaction that
+// last moved references of a repository
+func (db *T) PutRefTransaction(name string, refs []string, hash types.Hash) (e error) {
+	writable(&e, db, func(dbtx *bolt.Tx) bool {
+		var bucket *bolt.Bucket
+		if bucket, e = dbtx.CreateBucketIfNotExists(append([]byte("ref_transactions"), []byte(name)...)); e != nil {
+			return false
+		}
+		for i := range refs {
+			if e = bucket.Put([]byte(refs[i]), hash); e != nil {
+				return false
+			}
+		}
+		return true
+	})
+	return
+}
+
+// GetRefTransaction returns the transaction that last moved a reference,
+// or nil if it was never moved by a confirmed transaction
+func (db *T) GetRefTransaction(name, ref string) (hash types.Hash, e error) {
+	readable(&e, db, func(dbtx *bolt.Tx) {
+		bucket := dbtx.Bucket(append([]byte("ref_transactions"), []byte(name)...))
+		if bucket == nil {
+			return // return no error because no references were moved
+		}
+		hash = copyValue(bucket.Get([]byte(ref)))
+	})
+	return
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spx/gitchain/repository"
+	"github.com/spx/gitchain/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutGetRefUpdateStatus(t *testing.T) {
+	db, err := NewDB("test.db")
+	defer os.Remove("test.db")
+
+	if err != nil {
+		t.Errorf("error opening database: %v", err)
+	}
+
+	hash := util.SHA256([]byte("transaction"))
+	status, err := db.GetRefUpdateStatus(hash)
+	assert.Nil(t, err)
+	assert.Equal(t, status, "")
+
+	err = db.PutRefUpdateStatus(hash, repository.REF_UPDATE_APPLIED)
+	if err != nil {
+		t.Errorf("error putting reference update status: %v", err)
+	}
+	status, err = db.GetRefUpdateStatus(hash)
+	if err != nil {
+		t.Errorf("error getting reference update status: %v", err)
+	}
+	assert.Equal(t, status, repository.REF_UPDATE_APPLIED)
+
+	status, err = db.GetRefUpdateStatus(util.SHA256([]byte("another transaction")))
+	assert.Nil(t, err)
+	assert.Equal(t, status, "")
+}
+
+func TestPutGetRefTransaction(t *testing.T) {
+	db, err := NewDB("test.db")
+	defer os.Remove("test.db")
+
+	if err != nil {
+		t.Errorf("error opening database: %v", err)
+	}
+
+	hash, err := db.GetRefTransaction("repo", "refs/heads/master")
+	assert.Nil(t, err)
+	assert.Nil(t, hash)
+
+	txn := util.SHA256([]byte("transaction"))
+	err = db.PutRefTransaction("repo", []string{"refs/heads/master", "refs/tags/v1"}, txn)
+	if err != nil {
+		t.Errorf("error putting reference transaction: %v", err)
+	}
+	hash, err = db.GetRefTransaction("repo", "refs/tags/v1")
+	if err != nil {
+		t.Errorf("error getting reference transaction: %v", err)
+	}
+	assert.Equal(t, []byte(hash), txn)
+
+	hash, err = db.GetRefTransaction("another", "refs/tags/v1")
+	assert.Nil(t, err)
+	assert.Nil(t, hash)
+}
@@ -1,6 +1,8 @@
 package db
 
 import (
+	"fmt"
+
 	"github.com/boltdb/bolt"
 	"github.com/spx/gitchain/repository"
 )
@@ -110,6 +112,50 @@ func (db *T) PutRef(name, ref string, new repository.Ref) (e error) {
 	return
 }
 
+// UpdateRef sets a reference to new provided it currently points to old
+// (a missing reference pointing to the empty ref), deleting it when new
+// is the empty ref. It returns false if the reference was left untouched.
+func (db *T) UpdateRef(name, ref string, old, new repository.Ref) (bool, error) {
+	return db.UpdateRefs(name, []repository.RefUpdate{{Ref: ref, Old: old, New: new}})
+}
+
+// UpdateRefs applies several reference updates the way UpdateRef does,
+// either all of them or none if a reference doesn't point to its old value
+func (db *T) UpdateRefs(name string, updates []repository.RefUpdate) (updated bool, e error) {
+	writable(&e, db, func(dbtx *bolt.Tx) bool {
+		var bucket *bolt.Bucket
+		if _, e = dbtx.CreateBucketIfNotExists([]byte("repositories")); e != nil {
+			return false
+		}
+		if bucket, e = dbtx.CreateBucketIfNotExists(append([]byte("refs"), []byte(name)...)); e != nil {
+			return false
+		}
+
+		for i := range updates {
+			current := repository.Ref(bucket.Get([]byte(updates[i].Ref)))
+			if current == nil {
+				current = repository.EmptyRef()
+			}
+			if !current.Equals(updates[i].Old) {
+				return false
+			}
+		}
+		for i := range updates {
+			if updates[i].New.Equals(repository.EmptyRef()) {
+				e = bucket.Delete([]byte(updates[i].Ref))
+			} else {
+				e = bucket.Put([]byte(updates[i].Ref), updates[i].New)
+			}
+			if e != nil {
+				return false
+			}
+		}
+		updated = true
+		return true
+	})
+	return
+}
+
 func (db *T) GetRef(name, ref string) (h repository.Ref, e error) {
 	readable(&e, db, func(dbtx *bolt.Tx) {
 		bucket := dbtx.Bucket([]byte("repositories"))
@@ -122,7 +168,7 @@ func (db *T) GetRef(name, ref string) (h repository.Ref, e error) {
 			h = repository.EmptyRef() // return no error because there were no repositories saved
 			return
 		}
-		h = bucket.Get([]byte(ref))
+		h = copyValue(bucket.Get([]byte(ref)))
 		if h == nil {
 			h = repository.EmptyRef()
 		}
@@ -150,3 +196,21 @@ func (db *T) ListRefs(name string) (refs []string, e error) {
 	})
 	return
 }
+
+// GetRepositoryOwner returns the (encoded) public key that signed the name
+// allocation of a repository, or nil if the repository is unknown. The key
+// is in the current encoding, whatever the one it was published in.
+func (db *T) GetRepositoryOwner(name string) ([]byte, error) {
+	repo, err := db.GetRepository(name)
+	if err != nil || repo == nil {
+		return nil, err
+	}
+	allocation, err := db.GetTransaction(repo.NameAllocationTx)
+	if err != nil {
+		return nil, err
+	}
+	if allocation == nil {
+		return nil, fmt.Errorf("name allocation transaction %s of %s not found", repo.NameAllocationTx, name)
+	}
+	return normalizedPublicKey(allocation.PublicKey), nil
+}
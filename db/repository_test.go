@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/spx/gitchain/repository"
+	"github.com/spx/gitchain/transaction"
 	"github.com/spx/gitchain/types"
 	"github.com/spx/gitchain/util"
 	"github.com/stretchr/testify/assert"
@@ -34,6 +35,21 @@ func TestPutGetRepository(t *testing.T) {
 		t.Errorf("error getting repository `test'")
 	}
 	assert.Equal(t, repo, repo1)
+	assert.Equal(t, repo1.Head(), "refs/heads/master")
+
+	repo.DefaultBranch = "main"
+	repo.SetProtected("main", true)
+	err = db.PutRepository(repo)
+	if err != nil {
+		t.Errorf("error updating repository: %v", err)
+	}
+	repo1, err = db.GetRepository("test")
+	if err != nil {
+		t.Errorf("error getting repository: %v", err)
+	}
+	assert.Equal(t, repo1.Head(), "refs/heads/main")
+	assert.True(t, repo1.Protected("refs/heads/main"))
+	assert.False(t, repo1.Protected("refs/heads/master"))
 }
 
 func TestListRepository(t *testing.T) {
@@ -141,6 +157,84 @@ func TestPutGetRef(t *testing.T) {
 	assert.True(t, bytes.Compare(ref, ref1) == 0)
 }
 
+func TestUpdateRef(t *testing.T) {
+
+	db, err := NewDB("test.db")
+	defer os.Remove("test.db")
+
+	if err != nil {
+		t.Errorf("error opening database: %v", err)
+	}
+
+	ref := util.SHA160([]byte("random"))
+	ref1 := util.SHA160([]byte("not random"))
+
+	// only a missing ref can be created
+	updated, err := db.UpdateRef("myrepo", "refs/heads/master", ref1, ref)
+	assert.Nil(t, err)
+	assert.False(t, updated)
+	updated, err = db.UpdateRef("myrepo", "refs/heads/master", repository.EmptyRef(), ref)
+	assert.Nil(t, err)
+	assert.True(t, updated)
+
+	// stale updates are ignored
+	updated, err = db.UpdateRef("myrepo", "refs/heads/master", repository.EmptyRef(), ref1)
+	assert.Nil(t, err)
+	assert.False(t, updated)
+	updated, err = db.UpdateRef("myrepo", "refs/heads/master", ref, ref1)
+	assert.Nil(t, err)
+	assert.True(t, updated)
+	ref2, err := db.GetRef("myrepo", "refs/heads/master")
+	assert.Nil(t, err)
+	assert.True(t, ref2.Equals(ref1))
+
+	// updating to the empty ref deletes it
+	updated, err = db.UpdateRef("myrepo", "refs/heads/master", ref1, repository.EmptyRef())
+	assert.Nil(t, err)
+	assert.True(t, updated)
+	refs, err := db.ListRefs("myrepo")
+	assert.Nil(t, err)
+	assert.Equal(t, refs, []string{})
+}
+
+func TestUpdateRefs(t *testing.T) {
+
+	db, err := NewDB("test.db")
+	defer os.Remove("test.db")
+
+	if err != nil {
+		t.Errorf("error opening database: %v", err)
+	}
+
+	ref := util.SHA160([]byte("random"))
+	ref1 := util.SHA160([]byte("not random"))
+	err = db.PutRef("myrepo", "refs/heads/master", ref)
+	if err != nil {
+		t.Errorf("error putting repository ref: %v", err)
+	}
+
+	// nothing is applied if one of the references is stale
+	updated, err := db.UpdateRefs("myrepo", []repository.RefUpdate{
+		{Ref: "refs/heads/next", Old: repository.EmptyRef(), New: ref1},
+		{Ref: "refs/heads/master", Old: ref1, New: ref1},
+	})
+	assert.Nil(t, err)
+	assert.False(t, updated)
+	refs, err := db.ListRefs("myrepo")
+	assert.Nil(t, err)
+	assert.Equal(t, refs, []string{"refs/heads/master"})
+
+	updated, err = db.UpdateRefs("myrepo", []repository.RefUpdate{
+		{Ref: "refs/heads/next", Old: repository.EmptyRef(), New: ref1},
+		{Ref: "refs/heads/master", Old: ref, New: repository.EmptyRef()},
+	})
+	assert.Nil(t, err)
+	assert.True(t, updated)
+	refs, err = db.ListRefs("myrepo")
+	assert.Nil(t, err)
+	assert.Equal(t, refs, []string{"refs/heads/next"})
+}
+
 func TestListRefs(t *testing.T) {
 
 	db, err := NewDB("test.db")
@@ -173,3 +267,36 @@ func TestListRefs(t *testing.T) {
 
 	assert.Equal(t, refs, []string{"refs/heads/master", "refs/heads/next"})
 }
+
+func TestGetRepositoryOwner(t *testing.T) {
+	privateKey := generateECDSAKey(t)
+	txn, _ := transaction.NewNameAllocation("test", []byte("random"))
+	txne := transaction.NewEnvelope(types.EmptyHash(), txn)
+	txne.Sign(privateKey)
+
+	db, err := NewDB("test.db")
+	defer os.Remove("test.db")
+
+	if err != nil {
+		t.Errorf("error opening database: %v", err)
+	}
+
+	owner, err := db.GetRepositoryOwner("test")
+	assert.Nil(t, err)
+	assert.Nil(t, owner)
+
+	err = db.PutRepository(repository.NewRepository("test", repository.ACTIVE, txne.Hash()))
+	if err != nil {
+		t.Errorf("error putting repository: %v", err)
+	}
+	_, err = db.GetRepositoryOwner("test")
+	assert.NotNil(t, err) // allocation transaction is missing
+
+	err = db.PutTransaction(txne)
+	if err != nil {
+		t.Errorf("error putting transaction: %v", err)
+	}
+	owner, err = db.GetRepositoryOwner("test")
+	assert.Nil(t, err)
+	assert.Equal(t, owner, txne.PublicKey)
+}
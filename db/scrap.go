@@ -25,7 +25,7 @@ func (db *T) GetScrap(key []byte) (b []byte, e error) {
 			e = errors.New("scraps bucket does not exist")
 			return
 		}
-		b = bucket.Get(key)
+		b = copyValue(bucket.Get(key))
 	})
 	return
 }
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"github.com/boltdb/bolt"
+	"github.com/spx/gitchain/util"
+)
+
+// PutSigningKey records a commit signing key published by the holder of
+// an (encoded) envelope public key
+func (db *T) PutSigningKey(owner, key []byte) (e error) {
+	writable(&e, db, func(dbtx *bolt.Tx) bool {
+		var bucket *bolt.Bucket
+		if bucket, e = dbtx.CreateBucketIfNotExists(append([]byte("signing_keys"), normalizedPublicKey(owner)...)); e != nil {
+			return false
+		}
+		e = bucket.Put(util.SHA256(key), key)
+		return e == nil
+	})
+	return
+}
+
+// ListSigningKeys returns the commit signing keys published by the holder
+// of an (encoded) envelope public key
+func (db *T) ListSigningKeys(owner []byte) (keys [][]byte, e error) {
+	readable(&e, db, func(dbtx *bolt.Tx) {
+		bucket := dbtx.Bucket(append([]byte("signing_keys"), normalizedPublicKey(owner)...))
+		if bucket == nil {
+			return // no keys were published
+		}
+		bucket.ForEach(func(k, v []byte) error {
+			keys = append(keys, append([]byte{}, v...))
+			return nil
+		})
+	})
+	return
+}
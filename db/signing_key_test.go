@@ -0,0 +1,40 @@
+package db
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutListSigningKeys(t *testing.T) {
+	db, err := NewDB("test.db")
+	defer os.Remove("test.db")
+
+	if err != nil {
+		t.Errorf("error opening database: %v", err)
+	}
+
+	keys, err := db.ListSigningKeys([]byte("owner"))
+	assert.Nil(t, err)
+	assert.Empty(t, keys)
+
+	for _, key := range []string{"key1", "key2", "key1"} {
+		err = db.PutSigningKey([]byte("owner"), []byte(key))
+		if err != nil {
+			t.Errorf("error putting signing key: %v", err)
+		}
+	}
+	err = db.PutSigningKey([]byte("other owner"), []byte("key3"))
+	if err != nil {
+		t.Errorf("error putting signing key: %v", err)
+	}
+
+	keys, err = db.ListSigningKeys([]byte("owner"))
+	if err != nil {
+		t.Errorf("error listing signing keys: %v", err)
+	}
+	assert.Equal(t, len(keys), 2)
+	assert.Contains(t, keys, []byte("key1"))
+	assert.Contains(t, keys, []byte("key2"))
+}
@@ -0,0 +1,32 @@
+package db
+
+import (
+	"github.com/boltdb/bolt"
+)
+
+// PutSSHKey authorizes an SSH public key (in wire format) to push on
+// behalf of the keypair stored under alias
+func (db *T) PutSSHKey(key []byte, alias string) (e error) {
+	writable(&e, db, func(dbtx *bolt.Tx) bool {
+		var bucket *bolt.Bucket
+		if bucket, e = dbtx.CreateBucketIfNotExists([]byte("ssh_keys")); e != nil {
+			return false
+		}
+		e = bucket.Put(key, []byte(alias))
+		return e == nil
+	})
+	return
+}
+
+// GetSSHKeyAlias returns the alias of the keypair an SSH public key is
+// authorized for, or an empty string
+func (db *T) GetSSHKeyAlias(key []byte) (alias string, e error) {
+	readable(&e, db, func(dbtx *bolt.Tx) {
+		bucket := dbtx.Bucket([]byte("ssh_keys"))
+		if bucket == nil {
+			return // return no error because there were no keys saved
+		}
+		alias = string(bucket.Get(key))
+	})
+	return
+}
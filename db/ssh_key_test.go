@@ -0,0 +1,35 @@
+package db
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPutGetSSHKey(t *testing.T) {
+	db, err := NewDB("test.db")
+	defer os.Remove("test.db")
+
+	if err != nil {
+		t.Errorf("error opening database: %v", err)
+	}
+
+	alias, err := db.GetSSHKeyAlias([]byte("ssh key"))
+	assert.Nil(t, err)
+	assert.Equal(t, alias, "")
+
+	err = db.PutSSHKey([]byte("ssh key"), "alice")
+	if err != nil {
+		t.Errorf("error putting SSH key: %v", err)
+	}
+	alias, err = db.GetSSHKeyAlias([]byte("ssh key"))
+	if err != nil {
+		t.Errorf("error getting SSH key: %v", err)
+	}
+	assert.Equal(t, alias, "alice")
+
+	alias, err = db.GetSSHKeyAlias([]byte("another ssh key"))
+	assert.Nil(t, err)
+	assert.Equal(t, alias, "")
+}
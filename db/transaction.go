@@ -57,6 +57,16 @@ func (db *T) GetTransactionConfirmations(hash []byte) (int, error) {
 	}
 }
 
+// normalizedPublicKey returns the current encoding of an encoded public
+// key, which is how public keys are indexed whatever encoding they were
+// published in. Anything that isn't a public key is returned as is.
+func normalizedPublicKey(b []byte) []byte {
+	if normalized, err := keys.NormalizeECDSAPublicKey(b); err == nil {
+		return normalized
+	}
+	return b
+}
+
 func (db *T) GetPreviousEnvelopeHashForPublicKey(publicKey *ecdsa.PublicKey) (h types.Hash, e error) {
 	enc, e := keys.EncodeECDSAPublicKey(publicKey)
 	if e != nil {
@@ -65,7 +75,7 @@ func (db *T) GetPreviousEnvelopeHashForPublicKey(publicKey *ecdsa.PublicKey) (h
 	readable(&e, db, func(dbtx *bolt.Tx) {
 		bucket := dbtx.Bucket([]byte("blocks"))
 		if bucket != nil {
-			h = bucket.Get(append([]byte("<"), enc...))
+			h = copyValue(bucket.Get(append([]byte("<"), enc...)))
 		}
 	})
 	return
@@ -75,7 +85,7 @@ func (db *T) GetNextTransactionHash(hash []byte) (h types.Hash, e error) {
 	readable(&e, db, func(dbtx *bolt.Tx) {
 		bucket := dbtx.Bucket([]byte("blocks"))
 		if bucket != nil {
-			h = bucket.Get(append([]byte(">"), hash...))
+			h = copyValue(bucket.Get(append([]byte(">"), hash...)))
 			if h == nil {
 				h = types.EmptyHash()
 			}
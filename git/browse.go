@@ -0,0 +1,98 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PeelToCommit returns the commit h points to, following annotated tags
+func PeelToCommit(read func(Hash) (Object, error), h Hash) (*Commit, error) {
+	for {
+		obj, err := read(h)
+		if err != nil {
+			return nil, err
+		}
+		switch o := obj.(type) {
+		case *Commit:
+			return o, nil
+		case *Tag:
+			h = o.Object
+		default:
+			return nil, fmt.Errorf("%s is not a commit", obj)
+		}
+	}
+}
+
+// LookupPath returns the object found at a slash separated path within
+// a tree, the tree itself for an empty path
+func LookupPath(read func(Hash) (Object, error), tree Hash, path string) (Object, error) {
+	obj, err := read(tree)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+		t, ok := obj.(*Tree)
+		if !ok {
+			return nil, fmt.Errorf("path %s not found", path)
+		}
+		var found Hash
+		for i := range t.Entries {
+			if t.Entries[i].File == name {
+				if t.Entries[i].Mode == "160000" {
+					return nil, fmt.Errorf("path %s is in a submodule", path)
+				}
+				found = t.Entries[i].Hash
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("path %s not found", path)
+		}
+		if obj, err = read(found); err != nil {
+			return nil, err
+		}
+	}
+	return obj, nil
+}
+
+// Log returns up to limit commits reachable from tip (all of them if
+// limit isn't positive), most recently committed first
+func Log(read func(Hash) (Object, error), tip Hash, limit int) ([]*Commit, error) {
+	var commits []*Commit
+	commit, err := PeelToCommit(read, tip)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{string(commit.Hash()): true}
+	pending := []*Commit{commit}
+	for len(pending) > 0 && (limit <= 0 || len(commits) < limit) {
+		latest := 0
+		for i := range pending {
+			if pending[i].Time() > pending[latest].Time() {
+				latest = i
+			}
+		}
+		commit := pending[latest]
+		pending = append(pending[0:latest], pending[latest+1:]...)
+		commits = append(commits, commit)
+		for _, parent := range commit.Parents {
+			if seen[string(parent)] {
+				continue
+			}
+			seen[string(parent)] = true
+			obj, err := read(parent)
+			if err != nil {
+				return nil, err
+			}
+			c, ok := obj.(*Commit)
+			if !ok {
+				return nil, fmt.Errorf("parent %s of %s is not a commit", obj, commit)
+			}
+			pending = append(pending, c)
+		}
+	}
+	return commits, nil
+}
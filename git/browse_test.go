@@ -0,0 +1,79 @@
+package git
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fixtureBrowseRead(objects map[string]Object) func(Hash) (Object, error) {
+	return func(h Hash) (Object, error) {
+		if obj, ok := objects[string(h)]; ok {
+			return obj, nil
+		}
+		return nil, fmt.Errorf("missing object %s", h)
+	}
+}
+
+func TestPeelToCommit(t *testing.T) {
+	objects, tag, _, second := fixtureWalkerObjects(t)
+	read := fixtureBrowseRead(objects)
+
+	commit, err := PeelToCommit(read, tag.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, commit.Hash(), second.Hash())
+	commit, err = PeelToCommit(read, second.Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, commit.Hash(), second.Hash())
+	_, err = PeelToCommit(read, second.Tree)
+	assert.NotNil(t, err)
+}
+
+func TestLookupPath(t *testing.T) {
+	blob, tree, _ := fixtureFsckObjects(t)
+	root := &Tree{}
+	err := root.SetBytes(append(append([]byte("40000 dir\x00"), tree.Hash()...),
+		append([]byte("160000 submodule\x00"), blob.Hash()...)...))
+	if err != nil {
+		t.Errorf("error while decoding tree: %v", err)
+	}
+	read := fixtureBrowseRead(map[string]Object{
+		string(blob.Hash()): blob, string(tree.Hash()): tree, string(root.Hash()): root})
+
+	obj, err := LookupPath(read, root.Hash(), "")
+	assert.Nil(t, err)
+	assert.Equal(t, obj.Hash(), root.Hash())
+	obj, err = LookupPath(read, root.Hash(), "dir/")
+	assert.Nil(t, err)
+	assert.Equal(t, obj.Hash(), tree.Hash())
+	obj, err = LookupPath(read, root.Hash(), "/dir/hello.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, obj.Hash(), blob.Hash())
+
+	_, err = LookupPath(read, root.Hash(), "dir/missing")
+	assert.NotNil(t, err)
+	_, err = LookupPath(read, root.Hash(), "dir/hello.txt/file")
+	assert.NotNil(t, err)
+	_, err = LookupPath(read, root.Hash(), "submodule")
+	assert.NotNil(t, err)
+}
+
+func TestLog(t *testing.T) {
+	objects, tag, first, second := fixtureWalkerObjects(t)
+	read := fixtureBrowseRead(objects)
+
+	commits, err := Log(read, tag.Hash(), 0)
+	assert.Nil(t, err)
+	if assert.Equal(t, len(commits), 2) {
+		assert.Equal(t, commits[0].Hash(), second.Hash())
+		assert.Equal(t, commits[1].Hash(), first.Hash())
+	}
+	commits, err = Log(read, second.Hash(), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, len(commits), 1)
+
+	delete(objects, string(first.Hash()))
+	_, err = Log(read, second.Hash(), 0)
+	assert.NotNil(t, err)
+}
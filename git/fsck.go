@@ -0,0 +1,101 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+var validTreeModes = map[string]bool{
+	"40000":  true,
+	"100644": true,
+	"100664": true, // produced by some old versions of git
+	"100755": true,
+	"120000": true,
+	"160000": true,
+}
+
+// Fsck verifies objects received in a packfile before any
+// references are allowed to point to them
+type Fsck struct {
+	pack  *Packfile
+	known func(Hash) bool
+}
+
+// NewFsck prepares a check of a packfile against a set of objects that
+// are already known (and assumed to be connected), as reported by known
+func NewFsck(p *Packfile, known func(Hash) bool) *Fsck {
+	return &Fsck{pack: p, known: known}
+}
+
+// CheckObjects validates the syntax of every object in the packfile
+func (f *Fsck) CheckObjects() error {
+	for i := range f.pack.Objects {
+		if err := FsckObject(f.pack.Objects[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckConnectivity verifies that tip and everything reachable from it is
+// either contained in the packfile or already known
+func (f *Fsck) CheckConnectivity(tip Hash) error {
+	walker := NewWalker(func(h Hash) (Object, error) {
+		if obj := f.pack.ObjectByHash(h); obj != nil {
+			return obj, nil
+		}
+		if f.known(h) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("missing object %s", h)
+	})
+	return walker.Walk([]Hash{tip}, nil)
+}
+
+// FsckObject checks that an object is well-formed
+func FsckObject(obj Object) error {
+	switch o := obj.(type) {
+	case *Commit:
+		if len(o.Tree) != 20 {
+			return fmt.Errorf("%s: missing tree", o)
+		}
+		for i := range o.Parents {
+			if len(o.Parents[i]) != 20 {
+				return fmt.Errorf("%s: malformed parent", o)
+			}
+		}
+		if len(o.Author) == 0 {
+			return fmt.Errorf("%s: missing author", o)
+		}
+		if len(o.Committer) == 0 {
+			return fmt.Errorf("%s: missing committer", o)
+		}
+	case *Tree:
+		names := make(map[string]bool)
+		for i := range o.Entries {
+			entry := o.Entries[i]
+			if !validTreeModes[entry.Mode] {
+				return fmt.Errorf("%s: invalid mode %s for %q", o, entry.Mode, entry.File)
+			}
+			if entry.File == "" || entry.File == "." || entry.File == ".." ||
+				strings.Contains(entry.File, "/") {
+				return fmt.Errorf("%s: invalid entry name %q", o, entry.File)
+			}
+			if names[entry.File] {
+				return fmt.Errorf("%s: duplicate entry %q", o, entry.File)
+			}
+			names[entry.File] = true
+			if len(entry.Hash) != 20 {
+				return fmt.Errorf("%s: malformed hash for %q", o, entry.File)
+			}
+		}
+	case *Tag:
+		if len(o.Object) != 20 {
+			return fmt.Errorf("%s: malformed object hash", o)
+		}
+		if o.ObjectType == "" {
+			return fmt.Errorf("%s: missing object type", o)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package git
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fixtureFsckObjects(t *testing.T) (*Blob, *Tree, *Commit) {
+	blob := &Blob{}
+	blob.SetBytes([]byte("hello\n"))
+	tree := &Tree{}
+	err := tree.SetBytes(append([]byte("100644 hello.txt\x00"), blob.Hash()...))
+	if err != nil {
+		t.Errorf("error while decoding tree: %v", err)
+	}
+	commit := &Commit{}
+	err = commit.SetBytes([]byte(fmt.Sprintf("tree %x\nauthor A U Thor <author@example.com> 1400000000 +0000\ncommitter A U Thor <author@example.com> 1400000000 +0000\n\nInitial commit\n", tree.Hash())))
+	if err != nil {
+		t.Errorf("error while decoding commit: %v", err)
+	}
+	return blob, tree, commit
+}
+
+func TestFsckObject(t *testing.T) {
+	blob, tree, commit := fixtureFsckObjects(t)
+	assert.Nil(t, FsckObject(blob))
+	assert.Nil(t, FsckObject(tree))
+	assert.Nil(t, FsckObject(commit))
+
+	empty := &Tree{}
+	assert.Nil(t, empty.SetBytes([]byte{}))
+	assert.Nil(t, FsckObject(empty))
+
+	badTree := &Tree{}
+	badTree.SetBytes(append([]byte("100644 a/b\x00"), blob.Hash()...))
+	assert.NotNil(t, FsckObject(badTree))
+
+	badMode := &Tree{}
+	badMode.SetBytes(append([]byte("777 a\x00"), blob.Hash()...))
+	assert.NotNil(t, FsckObject(badMode))
+
+	truncated := &Tree{}
+	assert.NotNil(t, truncated.SetBytes(append([]byte("100644 a\x00"), blob.Hash()[0:10]...)))
+
+	noTree := &Commit{}
+	noTree.SetBytes([]byte("author A U Thor <author@example.com> 1400000000 +0000\n\nNo tree\n"))
+	assert.NotNil(t, FsckObject(noTree))
+
+	badTag := &Tag{}
+	badTag.SetBytes([]byte("type commit\ntag v1\n\nNo object\n"))
+	assert.NotNil(t, FsckObject(badTag))
+}
+
+func TestFsckConnectivity(t *testing.T) {
+	blob, tree, commit := fixtureFsckObjects(t)
+	none := func(Hash) bool { return false }
+
+	fsck := NewFsck(NewPackfile([]Object{commit, tree, blob}), none)
+	assert.Nil(t, fsck.CheckObjects())
+	assert.Nil(t, fsck.CheckConnectivity(commit.Hash()))
+
+	fsck = NewFsck(NewPackfile([]Object{commit, tree}), none)
+	assert.NotNil(t, fsck.CheckConnectivity(commit.Hash()))
+	assert.NotNil(t, fsck.CheckConnectivity(blob.Hash()))
+
+	fsck = NewFsck(NewPackfile([]Object{commit, tree}), func(h Hash) bool {
+		return h.String() == Hash(blob.Hash()).String()
+	})
+	assert.Nil(t, fsck.CheckConnectivity(commit.Hash()))
+}
+
+func TestFsckConnectivitySkipsGitlinks(t *testing.T) {
+	blob, _, _ := fixtureFsckObjects(t)
+	tree := &Tree{}
+	tree.SetBytes(append([]byte("160000 submodule\x00"), blob.Hash()...))
+	fsck := NewFsck(NewPackfile([]Object{tree}), func(Hash) bool { return false })
+	assert.Nil(t, fsck.CheckObjects())
+	assert.Nil(t, fsck.CheckConnectivity(tree.Hash()))
+}
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"compress/zlib"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
+	"strings"
 
 	"github.com/spx/gitchain/util"
 )
@@ -36,9 +39,57 @@ type Commit struct {
 	Parents   []Hash
 	Author    string
 	Committer string
+	Encoding  string
+	// Signature is the gpgsig header, if the commit is signed
+	Signature string
+	// MergeTags holds the tags embedded in merge commits
+	MergeTags []string
+	Headers   []Header
 	Message   string
 }
 
+// Header is a line of a commit or tag header. The continuation lines of
+// multi-line headers are joined to the value with newlines.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// parseHeaders splits the content of a commit or tag into its headers
+// and message
+func parseHeaders(b []byte) (headers []Header, message []byte) {
+	for len(b) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(b, '\n'); i >= 0 {
+			line, b = b[:i], b[i+1:]
+		} else {
+			line, b = b, nil
+		}
+		switch {
+		case len(line) == 0:
+			return headers, b
+		case line[0] == ' ' && len(headers) > 0:
+			headers[len(headers)-1].Value += "\n" + string(line[1:])
+		default:
+			split := bytes.SplitN(line, []byte{' '}, 2)
+			header := Header{Name: string(split[0])}
+			if len(split) > 1 {
+				header.Value = string(split[1])
+			}
+			headers = append(headers, header)
+		}
+	}
+	return
+}
+
+func decodeHash(s string) (Hash, error) {
+	h, err := hex.DecodeString(s)
+	if err == nil && len(h) != 20 {
+		err = fmt.Errorf("invalid hash %q", s)
+	}
+	return h, err
+}
+
 func (o *Commit) Type() string {
 	return "commit"
 }
@@ -48,37 +99,61 @@ func (o *Commit) Hash() []byte {
 }
 
 func (o *Commit) SetBytes(b []byte) (err error) {
-	o.Content = b
-	lines := bytes.Split(b, []byte{'\n'})
-	for i := range lines {
-		if len(lines[i]) > 0 {
-			split := bytes.SplitN(lines[i], []byte{' '}, 2)
-			switch string(split[0]) {
-			case "tree":
-				o.Tree = make([]byte, 20)
-				_, err = hex.Decode(o.Tree, split[1])
-			case "parent":
-				h := make([]byte, 20)
-				_, err = hex.Decode(h, split[1])
-				if err == nil {
-					o.Parents = append(o.Parents, h)
-				}
-			case "author":
-				o.Author = string(split[1])
-			case "committer":
-				o.Committer = string(split[1])
+	// the commit may be reused, nothing from a previous decoding is kept
+	*o = Commit{Content: b}
+	headers, message := parseHeaders(b)
+	o.Headers = headers
+	o.Message = string(message)
+	for _, header := range headers {
+		switch header.Name {
+		case "tree":
+			if o.Tree, err = decodeHash(header.Value); err != nil {
+				return
 			}
-			if err != nil {
+		case "parent":
+			var h Hash
+			if h, err = decodeHash(header.Value); err != nil {
 				return
 			}
-		} else {
-			o.Message = string(bytes.Join(append(lines[i+1:]), []byte{'\n'}))
-			break
+			o.Parents = append(o.Parents, h)
+		case "author":
+			o.Author = header.Value
+		case "committer":
+			o.Committer = header.Value
+		case "encoding":
+			o.Encoding = header.Value
+		case "gpgsig":
+			o.Signature = header.Value
+		case "mergetag":
+			o.MergeTags = append(o.MergeTags, header.Value)
 		}
 	}
 	return
 }
 
+// SignedPayload returns the content covered by the commit's signature,
+// that is the commit without its gpgsig header
+func (o *Commit) SignedPayload() []byte {
+	var payload []byte
+	lines := bytes.SplitAfter(o.Content, []byte{'\n'})
+	for i := 0; i < len(lines); i++ {
+		if len(lines[i]) == 0 || lines[i][0] == '\n' {
+			for ; i < len(lines); i++ {
+				payload = append(payload, lines[i]...)
+			}
+			break
+		}
+		if bytes.HasPrefix(lines[i], []byte("gpgsig ")) {
+			for i+1 < len(lines) && len(lines[i+1]) > 0 && lines[i+1][0] == ' ' {
+				i++
+			}
+			continue
+		}
+		payload = append(payload, lines[i]...)
+	}
+	return payload
+}
+
 func (o *Commit) Bytes() []byte {
 	return o.Content
 }
@@ -87,6 +162,16 @@ func (o *Commit) New() Object {
 	return &Commit{}
 }
 
+// Time returns the committer timestamp of a commit
+func (o *Commit) Time() int64 {
+	fields := strings.Fields(o.Committer)
+	if len(fields) < 2 {
+		return 0
+	}
+	t, _ := strconv.ParseInt(fields[len(fields)-2], 10, 64)
+	return t
+}
+
 func (o *Commit) String() string {
 	return fmt.Sprintf("commit %x", o.Hash())
 }
@@ -120,19 +205,23 @@ func (o *Tree) SetBytes(b []byte) (err error) {
 	}
 
 	o.Content = b
+	o.Entries = nil
 	body := b
 
-	for {
-		split := bytes.SplitN(body, []byte{0}, 2)
-		split1 := bytes.SplitN(split[0], []byte{' '}, 2)
-		o.Entries = append(o.Entries, treeEntry{
-			Mode: string(split1[0]),
-			File: string(split1[1]),
-			Hash: split[1][0:20]})
-		body = split[1][20:]
-		if len(split[1]) == 20 {
-			break
+	for len(body) > 0 {
+		nul := bytes.IndexByte(body, 0)
+		if nul < 0 || len(body) < nul+21 {
+			return errors.New("malformed tree entry")
+		}
+		sp := bytes.IndexByte(body[0:nul], ' ')
+		if sp < 0 {
+			return errors.New("malformed tree entry mode")
 		}
+		o.Entries = append(o.Entries, treeEntry{
+			Mode: string(body[0:sp]),
+			File: string(body[sp+1 : nul]),
+			Hash: body[nul+1 : nul+21]})
+		body = body[nul+21:]
 	}
 	return
 }
@@ -179,7 +268,23 @@ func (o *Blob) String() string {
 }
 
 type Tag struct {
-	Content []byte
+	Content    []byte
+	Object     Hash
+	ObjectType string
+	Tag        string
+	Tagger     string
+	Headers    []Header
+	Message    string
+	// Signature is the signature block appended to the message, if the
+	// tag is signed
+	Signature string
+}
+
+// signature blocks can be appended to a tag's message by git tag -s
+var tagSignatureMarkers = [][]byte{
+	[]byte("-----BEGIN PGP SIGNATURE-----"),
+	[]byte("-----BEGIN SSH SIGNATURE-----"),
+	[]byte("-----BEGIN SIGNED MESSAGE-----"),
 }
 
 func (o *Tag) Type() string {
@@ -195,10 +300,57 @@ func (o *Tag) Bytes() []byte {
 }
 
 func (o *Tag) SetBytes(b []byte) (err error) {
-	o.Content = b
+	// the tag may be reused, nothing from a previous decoding is kept
+	*o = Tag{Content: b}
+	headers, message := parseHeaders(b)
+	o.Headers = headers
+	for _, header := range headers {
+		switch header.Name {
+		case "object":
+			if o.Object, err = decodeHash(header.Value); err != nil {
+				return
+			}
+		case "type":
+			o.ObjectType = header.Value
+		case "tag":
+			o.Tag = header.Value
+		case "tagger":
+			o.Tagger = header.Value
+		}
+	}
+	if i := signatureStart(message); i >= 0 {
+		o.Message, o.Signature = string(message[:i]), string(message[i:])
+	} else {
+		o.Message = string(message)
+	}
 	return
 }
 
+// signatureStart returns the offset of the last line of a tag's message
+// starting a signature block, or -1
+func signatureStart(message []byte) int {
+	start := -1
+	for i := 0; i < len(message); {
+		for _, marker := range tagSignatureMarkers {
+			if bytes.HasPrefix(message[i:], marker) {
+				start = i
+			}
+		}
+		eol := bytes.IndexByte(message[i:], '\n')
+		if eol < 0 {
+			break
+		}
+		i += eol + 1
+	}
+	return start
+}
+
+// SignedPayload returns the content covered by the tag's signature, that
+// is the tag without its signature block
+func (o *Tag) SignedPayload() []byte {
+	return o.Content[:len(o.Content)-len(o.Signature)]
+}
+
 func (o *Tag) New() Object {
 	return &Tag{}
 }
@@ -207,6 +359,11 @@ func (o *Tag) String() string {
 	return fmt.Sprintf("tag %x", o.Hash())
 }
 
+func objectPath(h Hash, dir string) string {
+	hash := hex.EncodeToString(h)
+	return path.Join(dir, hash[0:2], hash[2:])
+}
+
 func WriteObject(o Object, dir string) (err error) {
 	hash := []byte(hex.EncodeToString(o.Hash()))
 	hd := hash[0:2]
@@ -218,8 +375,66 @@ func WriteObject(o Object, dir string) (err error) {
 	return ioutil.WriteFile(path.Join(dir, string(hd), string(tl)), ObjectToBytes(o), 0600)
 }
 
+func ReadObject(h Hash, dir string) (Object, error) {
+	b, err := ioutil.ReadFile(objectPath(h, dir))
+	if err != nil {
+		return nil, err
+	}
+	o := DecodeObject(b)
+	if o == nil {
+		return nil, fmt.Errorf("object %s is malformed", h)
+	}
+	return o, nil
+}
+
+func ObjectExists(h Hash, dir string) bool {
+	_, err := os.Stat(objectPath(h, dir))
+	return err == nil
+}
+
+// StatObject describes the file an object is stored in
+func StatObject(h Hash, dir string) (os.FileInfo, error) {
+	return os.Stat(objectPath(h, dir))
+}
+
+// RemoveObject deletes an object from dir
+func RemoveObject(h Hash, dir string) error {
+	return os.Remove(objectPath(h, dir))
+}
+
+// ListObjects returns the hashes of all objects stored in dir
+func ListObjects(dir string) (hashes []Hash, err error) {
+	dirs, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return
+	}
+	for i := range dirs {
+		if !dirs[i].IsDir() || len(dirs[i].Name()) != 2 {
+			continue
+		}
+		var files []os.FileInfo
+		files, err = ioutil.ReadDir(path.Join(dir, dirs[i].Name()))
+		if err != nil {
+			return
+		}
+		for j := range files {
+			h, err := hex.DecodeString(dirs[i].Name() + files[j].Name())
+			if err == nil && len(h) == 20 {
+				hashes = append(hashes, h)
+			}
+		}
+	}
+	return hashes, nil
+}
+
 func DecodeObject(b []byte) (o Object) {
 	split := bytes.SplitN(b, []byte{0}, 2)
+	if len(split) != 2 {
+		return nil
+	}
 	hdr := bytes.Split(split[0], []byte(" "))
 	switch string(hdr[0]) {
 	case "commit":
@@ -230,6 +445,8 @@ func DecodeObject(b []byte) (o Object) {
 		o = &Blob{}
 	case "tag":
 		o = &Tag{}
+	default:
+		return nil
 	}
 	o.SetBytes(split[1])
 	return
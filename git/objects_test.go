@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"compress/zlib"
 	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -40,6 +43,116 @@ func TestCommitDecode(t *testing.T) {
 	assert.Equal(t, c.Author, "Yurii Rashkovskii <yrashk@gmail.com> 1400767572 +0800")
 	assert.Equal(t, c.Committer, "Yurii Rashkovskii <yrashk@gmail.com> 1400767572 +0800")
 	assert.Equal(t, c.Message, "Add HACKING.md")
+
+	// parsing again doesn't accumulate parents
+	c.SetBytes([]byte(fixtureMultiparentCommit))
+	assert.Equal(t, len(c.Parents), 2)
+}
+
+const fixtureTag = `object 03a95d185ca6adeac9a1b4e0d2aaea9b208b3bf4
+type commit
+tag v0.1
+tagger Yurii Rashkovskii <yrashk@gmail.com> 1400915287 +0800
+
+First release
+`
+
+func TestTagDecode(t *testing.T) {
+	tag := &Tag{}
+	assert.Nil(t, tag.SetBytes([]byte(fixtureTag)))
+	assert.Equal(t, hex.EncodeToString(tag.Object), "03a95d185ca6adeac9a1b4e0d2aaea9b208b3bf4")
+	assert.Equal(t, tag.ObjectType, "commit")
+	assert.Equal(t, tag.Tag, "v0.1")
+	assert.Equal(t, tag.Tagger, "Yurii Rashkovskii <yrashk@gmail.com> 1400915287 +0800")
+	assert.Equal(t, tag.Message, "First release\n")
+	assert.Equal(t, tag.Signature, "")
+	assert.Equal(t, tag.SignedPayload(), []byte(fixtureTag))
+}
+
+const fixtureSignedTagPayload = `object 03a95d185ca6adeac9a1b4e0d2aaea9b208b3bf4
+type commit
+tag v0.2
+tagger Yurii Rashkovskii <yrashk@gmail.com> 1400915287 +0800
+
+Second release
+`
+
+const fixtureTagSignature = `-----BEGIN PGP SIGNATURE-----
+
+iQEcBAABAgAGBQJTgH0XAAoJEJ1Yr3fRZzj3pLUH/0Xz
+=Nc6a
+-----END PGP SIGNATURE-----
+`
+
+func TestSignedTagDecode(t *testing.T) {
+	tag := &Tag{}
+	assert.Nil(t, tag.SetBytes([]byte(fixtureSignedTagPayload+fixtureTagSignature)))
+	assert.Equal(t, tag.Tag, "v0.2")
+	assert.Equal(t, tag.Message, "Second release\n")
+	assert.Equal(t, tag.Signature, fixtureTagSignature)
+	assert.Equal(t, tag.SignedPayload(), []byte(fixtureSignedTagPayload))
+}
+
+const fixtureSignedCommit = `tree 69218c749588a7147b99ff45bf7d18db1bb126e8
+parent d3030ad8f6ad49e5ad69a2842f06940c60f9db6f
+author Yurii Rashkovskii <yrashk@gmail.com> 1400767572 +0800
+committer Yurii Rashkovskii <yrashk@gmail.com> 1400767572 +0800
+encoding ISO-8859-1
+gpgsig -----BEGIN PGP SIGNATURE-----
+ 
+ iQEcBAABAgAGBQJTgH0XAAoJEJ1Yr3fRZzj3pLUH/0Xz
+ =Nc6a
+ -----END PGP SIGNATURE-----
+mergetag object d3030ad8f6ad49e5ad69a2842f06940c60f9db61
+ type commit
+ tag v0.1
+
+Signed commit
+`
+
+func TestSignedCommitDecode(t *testing.T) {
+	c := &Commit{}
+	assert.Nil(t, c.SetBytes([]byte(fixtureSignedCommit)))
+	assert.Equal(t, hex.EncodeToString(c.Parents[0]), "d3030ad8f6ad49e5ad69a2842f06940c60f9db6f")
+	assert.Equal(t, c.Committer, "Yurii Rashkovskii <yrashk@gmail.com> 1400767572 +0800")
+	assert.Equal(t, c.Encoding, "ISO-8859-1")
+	assert.Equal(t, c.Signature, "-----BEGIN PGP SIGNATURE-----\n\niQEcBAABAgAGBQJTgH0XAAoJEJ1Yr3fRZzj3pLUH/0Xz\n=Nc6a\n-----END PGP SIGNATURE-----")
+	assert.Equal(t, c.MergeTags, []string{"object d3030ad8f6ad49e5ad69a2842f06940c60f9db61\ntype commit\ntag v0.1"})
+	assert.Equal(t, len(c.Headers), 7)
+	assert.Equal(t, c.Message, "Signed commit\n")
+	assert.Equal(t, string(c.SignedPayload()), `tree 69218c749588a7147b99ff45bf7d18db1bb126e8
+parent d3030ad8f6ad49e5ad69a2842f06940c60f9db6f
+author Yurii Rashkovskii <yrashk@gmail.com> 1400767572 +0800
+committer Yurii Rashkovskii <yrashk@gmail.com> 1400767572 +0800
+encoding ISO-8859-1
+mergetag object d3030ad8f6ad49e5ad69a2842f06940c60f9db61
+ type commit
+ tag v0.1
+
+Signed commit
+`)
+}
+
+func TestDecodeReusedObject(t *testing.T) {
+	c := &Commit{}
+	assert.Nil(t, c.SetBytes([]byte(fixtureSignedCommit)))
+	assert.Nil(t, c.SetBytes([]byte(fixtureMultiparentCommit)))
+	assert.Equal(t, c.Signature, "")
+	assert.Equal(t, c.Encoding, "")
+	assert.Nil(t, c.MergeTags)
+	assert.Equal(t, len(c.Parents), 2)
+
+	tag := &Tag{}
+	assert.Nil(t, tag.SetBytes([]byte(fixtureSignedTagPayload+fixtureTagSignature)))
+	assert.Nil(t, tag.SetBytes([]byte(fixtureTag)))
+	assert.Equal(t, tag.Signature, "")
+	assert.Equal(t, tag.Message, "First release\n")
+	assert.Equal(t, tag.SignedPayload(), []byte(fixtureTag))
+}
+
+func TestCommitDecodeInvalidHash(t *testing.T) {
+	c := &Commit{}
+	assert.NotNil(t, c.SetBytes([]byte("tree 69218c\n\nShort tree hash\n")))
 }
 
 var fixtureTree = []byte{
@@ -151,6 +264,46 @@ func TestTreeDecodeCompressed(t *testing.T) {
 	}
 }
 
+func TestListObjects(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitchain-objects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	hashes, err := ListObjects(path.Join(dir, "missing"))
+	assert.Nil(t, err)
+	assert.Empty(t, hashes)
+
+	blob := &Blob{}
+	blob.SetBytes([]byte("hello\n"))
+	assert.Nil(t, WriteObject(blob, dir))
+	hashes, err = ListObjects(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, hashes, []Hash{blob.Hash()})
+}
+
+func TestRemoveObject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitchain-objects")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	blob := &Blob{}
+	blob.SetBytes([]byte("hello\n"))
+	assert.Nil(t, WriteObject(blob, dir))
+	info, err := StatObject(blob.Hash(), dir)
+	assert.Nil(t, err)
+	assert.Equal(t, info.Size(), int64(len(ObjectToBytes(blob))))
+
+	assert.Nil(t, RemoveObject(blob.Hash(), dir))
+	assert.False(t, ObjectExists(blob.Hash(), dir))
+	_, err = StatObject(blob.Hash(), dir)
+	assert.True(t, os.IsNotExist(err))
+	assert.NotNil(t, RemoveObject(blob.Hash(), dir))
+}
+
 func hashFromString(h string) []byte {
 	b, err := hex.DecodeString(h)
 	if err != nil {
@@ -26,8 +26,10 @@ const (
 )
 
 type Delta struct {
-	Hash  []byte
+	Hash  []byte // base object, nil when it is another unresolved entry
 	Delta []byte
+	// offsets of the entry and of its base entry within the packfile
+	offset, baseOffset int
 }
 
 type Packfile struct {
@@ -55,11 +57,65 @@ func (r *Packfile) ObjectByOffset(offset int) Object {
 	return r.Objects[index]
 }
 
+// deferred tells whether the entry at offset is an unresolved delta
+func (r *Packfile) deferred(offset int) bool {
+	for i := range r.Deltas {
+		if r.Deltas[i].offset == offset {
+			return true
+		}
+	}
+	return false
+}
+
 func (r *Packfile) PutObject(o Object) {
 	r.Objects = append(r.Objects, o)
 	r.hashes[string(o.Hash())] = len(r.Objects) - 1
 }
 
+// ResolveDeltas patches the deltas that ReadPackfile couldn't resolve within
+// the packfile itself (as is the case with thin packs), looking up their base
+// objects outside of it with lookup (if provided). Deltas whose base can't be
+// found are left in Deltas.
+func (r *Packfile) ResolveDeltas(lookup func(Hash) (Object, error)) error {
+	for {
+		var unresolved []Delta
+		for i := range r.Deltas {
+			var ref Object
+			if r.Deltas[i].Hash == nil {
+				ref = r.ObjectByOffset(r.Deltas[i].baseOffset)
+			} else {
+				ref = r.ObjectByHash(r.Deltas[i].Hash)
+			}
+			if ref == nil && r.Deltas[i].Hash != nil && lookup != nil {
+				if obj, err := lookup(r.Deltas[i].Hash); err == nil {
+					ref = obj
+				}
+			}
+			if ref == nil {
+				unresolved = append(unresolved, r.Deltas[i])
+				continue
+			}
+			patched := PatchDelta(ref.Bytes(), r.Deltas[i].Delta)
+			if patched == nil {
+				return fmt.Errorf("error while patching %x", ref.Hash())
+			}
+			newObject := ref.New()
+			if err := newObject.SetBytes(patched); err != nil {
+				return err
+			}
+			r.PutObject(newObject)
+			if r.Deltas[i].offset > 0 {
+				r.offsets[r.Deltas[i].offset] = len(r.Objects) - 1
+			}
+		}
+		progress := len(unresolved) < len(r.Deltas)
+		r.Deltas = unresolved
+		if !progress {
+			return nil
+		}
+	}
+}
+
 func readMSBEncodedSize(reader io.Reader, initialOffset uint) uint64 {
 	var b byte
 	var sz uint64
@@ -81,15 +137,15 @@ func inflate(reader io.Reader, sz int) ([]byte, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error opening packfile's object zlib: %v", err)
 	}
-	buf := make([]byte, sz)
-
-	n, err := zr.Read(buf)
+	// read the stream through to its end so that the checksum trailer is
+	// consumed as well
+	buf, err := ioutil.ReadAll(zr)
 	if err != nil {
 		return nil, err
 	}
 
-	if n != sz {
-		return nil, fmt.Errorf("inflated size mismatch, expected %d, got %d", sz, n)
+	if len(buf) != sz {
+		return nil, fmt.Errorf("inflated size mismatch, expected %d, got %d", sz, len(buf))
 	}
 
 	zr.Close()
@@ -117,7 +173,7 @@ func readEntry(packfile *Packfile, reader flate.Reader, offset int) error {
 
 		referenced := packfile.ObjectByHash(ref)
 		if referenced == nil {
-			packfile.Deltas = append(packfile.Deltas, Delta{Hash: ref, Delta: buf})
+			packfile.Deltas = append(packfile.Deltas, Delta{Hash: ref, Delta: buf, offset: offset})
 		} else {
 			patched := PatchDelta(referenced.Bytes(), buf)
 			if patched == nil {
@@ -150,7 +206,12 @@ func readEntry(packfile *Packfile, reader flate.Reader, offset int) error {
 		}
 		referenced := packfile.ObjectByOffset(offset - noffset)
 		if referenced == nil {
-			return fmt.Errorf("can't find a pack entry at %d", offset-noffset)
+			if !packfile.deferred(offset - noffset) {
+				return fmt.Errorf("can't find a pack entry at %d", offset-noffset)
+			}
+			// the base is a delta against an object outside of
+			// the packfile
+			packfile.Deltas = append(packfile.Deltas, Delta{Delta: buf, offset: offset, baseOffset: offset - noffset})
 		} else {
 			patched := PatchDelta(referenced.Bytes(), buf)
 			if patched == nil {
@@ -182,7 +243,9 @@ func readEntry(packfile *Packfile, reader flate.Reader, offset int) error {
 		case OBJ_TAG:
 			obj = &Tag{}
 		}
-		obj.SetBytes(buf)
+		if err = obj.SetBytes(buf); err != nil {
+			return fmt.Errorf("malformed %s: %v", obj.Type(), err)
+		}
 		packfile.PutObject(obj)
 	default:
 		return fmt.Errorf("Invalid git object tag %03b", typ)
@@ -215,33 +278,24 @@ func ReadPackfile(r io.Reader) (*Packfile, error) {
 
 	for i := 0; i < int(objects); i++ {
 		peReader := &packEntryReader{reader: bytes.NewBuffer(content)}
+		resolved := len(packfile.Objects)
 		err := readEntry(packfile, peReader, offset)
 		if err != nil {
 			return packfile, err
 		}
-		packfile.offsets[offset] = len(packfile.Objects) - 1
+		if len(packfile.Objects) > resolved {
+			packfile.offsets[offset] = len(packfile.Objects) - 1
+		}
 
-		offset += peReader.Counter + 4
-		content = content[peReader.Counter+4:]
+		offset += peReader.Counter
+		content = content[peReader.Counter:]
 
 	}
 
-	var unresolvedDeltas []Delta
-	for i := range packfile.Deltas {
-		ref := packfile.ObjectByHash(packfile.Deltas[i].Hash)
-		if ref == nil {
-			unresolvedDeltas = append(unresolvedDeltas, packfile.Deltas[i])
-		} else {
-			patched := PatchDelta(ref.Bytes(), packfile.Deltas[i].Delta)
-			newObject := ref.New()
-			err = newObject.SetBytes(patched)
-			if err != nil {
-				return packfile, err
-			}
-			packfile.Objects = append(packfile.Objects, newObject)
-		}
+	err = packfile.ResolveDeltas(nil)
+	if err != nil {
+		return packfile, err
 	}
-	packfile.Deltas = unresolvedDeltas
 
 	packfile.Checksum = make([]byte, 20)
 	bytes.NewBuffer(content).Read(packfile.Checksum)
@@ -264,8 +318,9 @@ type packEntryReader struct {
 }
 
 func (r *packEntryReader) Read(p []byte) (int, error) {
-	r.Counter += (len(p))
-	return r.reader.Read(p)
+	n, err := r.reader.Read(p)
+	r.Counter += n
+	return n, err
 }
 
 func (r *packEntryReader) ReadByte() (byte, error) {
@@ -278,7 +333,11 @@ func (r *packEntryReader) ReadByte() (byte, error) {
 }
 
 func NewPackfile(objects []Object) *Packfile {
-	return &Packfile{Version: 2, Objects: objects, offsets: make(map[int]int), hashes: make(map[string]int)}
+	packfile := &Packfile{Version: 2, offsets: make(map[int]int), hashes: make(map[string]int)}
+	for i := range objects {
+		packfile.PutObject(objects[i])
+	}
+	return packfile
 }
 
 func writeEntry(w io.Writer, o Object) (err error) {
@@ -0,0 +1,84 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackfileWriteRead(t *testing.T) {
+	blob, tree, commit := fixtureFsckObjects(t)
+	var buf bytes.Buffer
+	err := WritePackfile(&buf, NewPackfile([]Object{commit, tree, blob}))
+	if err != nil {
+		t.Errorf("error while writing packfile: %v", err)
+	}
+	packfile, err := ReadPackfile(&buf)
+	if err != nil {
+		t.Errorf("error while reading packfile: %v", err)
+		return
+	}
+	assert.Equal(t, len(packfile.Objects), 3)
+	for _, o := range []Object{commit, tree, blob} {
+		read := packfile.ObjectByHash(o.Hash())
+		if assert.NotNil(t, read) {
+			assert.Equal(t, read.Bytes(), o.Bytes())
+		}
+	}
+}
+
+// packEntry encodes a small (< 16 bytes inflated) pack entry
+func packEntry(typ byte, header []byte, content []byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(typ<<4 | byte(len(content)))
+	buf.Write(header)
+	w := zlib.NewWriter(&buf)
+	w.Write(content)
+	w.Close()
+	return buf.Bytes()
+}
+
+// insertDelta encodes a delta replacing a base of srcSize bytes with content
+func insertDelta(srcSize int, content string) []byte {
+	return append([]byte{byte(srcSize), byte(len(content)), byte(len(content))}, content...)
+}
+
+func TestPackfileThinDeltaChain(t *testing.T) {
+	base := &Blob{Content: []byte("base\n")}
+	// a delta against an object outside of the packfile, and another
+	// one against that delta
+	first := packEntry(OBJ_REF_DELTA, base.Hash(), insertDelta(5, "first\n"))
+	second := packEntry(OBJ_OFS_DELTA, []byte{byte(len(first))}, insertDelta(6, "second\n"))
+	var buf bytes.Buffer
+	buf.WriteString("PACK")
+	binary.Write(&buf, binary.BigEndian, uint32(2))
+	binary.Write(&buf, binary.BigEndian, uint32(2))
+	buf.Write(first)
+	buf.Write(second)
+	checksum := sha1.Sum(buf.Bytes())
+	buf.Write(checksum[:])
+
+	packfile, err := ReadPackfile(&buf)
+	if err != nil {
+		t.Errorf("error while reading packfile: %v", err)
+		return
+	}
+	assert.Equal(t, len(packfile.Objects), 0)
+	assert.Equal(t, len(packfile.Deltas), 2)
+	err = packfile.ResolveDeltas(func(h Hash) (Object, error) {
+		if bytes.Compare(h, base.Hash()) == 0 {
+			return base, nil
+		}
+		return nil, fmt.Errorf("missing object %s", h)
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, len(packfile.Deltas), 0)
+	for _, content := range []string{"first\n", "second\n"} {
+		assert.NotNil(t, packfile.ObjectByHash((&Blob{Content: []byte(content)}).Hash()))
+	}
+}
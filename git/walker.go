@@ -0,0 +1,125 @@
+package git
+
+import "fmt"
+
+// Walker visits every object reachable from a set of tips exactly once,
+// following commit parents, tree entries and annotated tags. Gitlinks
+// (submodule commits) are not followed since they live in another
+// repository.
+type Walker struct {
+	read    func(Hash) (Object, error)
+	visited map[string]bool
+	// Shallow lists commits whose parents are not walked
+	Shallow map[string]bool
+	// Filter, when set, tells whether a tree or a blob reached from
+	// a commit is walked, depth being 0 for the commit's tree, 1 for
+	// its entries and so on. Objects that are neither walked nor
+	// visited can still be reached through another path.
+	Filter func(obj Object, depth int) bool
+}
+
+// NewWalker creates a walker retrieving objects with read. read may
+// return a nil Object (and no error) for objects that are known to be
+// complete, which are not walked any further.
+func NewWalker(read func(Hash) (Object, error)) *Walker {
+	return &Walker{read: read, visited: make(map[string]bool), Shallow: make(map[string]bool)}
+}
+
+// Hide marks h as visited, without walking it
+func (w *Walker) Hide(h Hash) {
+	w.visited[string(h)] = true
+}
+
+// Visited tells whether h has been visited (or hidden)
+func (w *Walker) Visited(h Hash) bool {
+	return w.visited[string(h)]
+}
+
+type walkItem struct {
+	hash Hash
+	// depth within the commit's tree, -1 outside of trees
+	depth int
+}
+
+// Walk calls fn for every object reachable from tips that hasn't been
+// visited yet. Tips are never filtered out.
+func (w *Walker) Walk(tips []Hash, fn func(Object) error) error {
+	var stack []walkItem
+	for i := len(tips) - 1; i >= 0; i-- {
+		stack = append(stack, walkItem{hash: tips[i], depth: -1})
+	}
+	for len(stack) > 0 {
+		item := stack[len(stack)-1]
+		stack = stack[0 : len(stack)-1]
+		if w.visited[string(item.hash)] {
+			continue
+		}
+		obj, err := w.read(item.hash)
+		if err != nil {
+			return err
+		}
+		if obj == nil {
+			w.visited[string(item.hash)] = true
+			continue
+		}
+		if item.depth >= 0 && w.Filter != nil && !w.Filter(obj, item.depth) {
+			continue
+		}
+		w.visited[string(item.hash)] = true
+		if fn != nil {
+			if err = fn(obj); err != nil {
+				return err
+			}
+		}
+		switch o := obj.(type) {
+		case *Commit:
+			if !w.Shallow[string(item.hash)] {
+				for i := len(o.Parents) - 1; i >= 0; i-- {
+					stack = append(stack, walkItem{hash: o.Parents[i], depth: -1})
+				}
+			}
+			stack = append(stack, walkItem{hash: o.Tree, depth: 0})
+		case *Tree:
+			depth := item.depth + 1
+			if depth == 0 { // a tree walked on its own
+				depth = 1
+			}
+			for i := len(o.Entries) - 1; i >= 0; i-- {
+				if o.Entries[i].Mode != "160000" {
+					stack = append(stack, walkItem{hash: o.Entries[i].Hash, depth: depth})
+				}
+			}
+		case *Tag:
+			stack = append(stack, walkItem{hash: o.Object, depth: -1})
+		}
+	}
+	return nil
+}
+
+// IsAncestor tells whether ancestor can be reached from descendant by
+// following commit parents (a commit being its own ancestor)
+func IsAncestor(read func(Hash) (Object, error), ancestor, descendant Hash) (bool, error) {
+	visited := make(map[string]bool)
+	stack := []Hash{descendant}
+	for len(stack) > 0 {
+		h := stack[len(stack)-1]
+		stack = stack[0 : len(stack)-1]
+		if string(h) == string(ancestor) {
+			return true, nil
+		}
+		if visited[string(h)] {
+			continue
+		}
+		visited[string(h)] = true
+		obj, err := read(h)
+		if err != nil {
+			return false, err
+		}
+		commit, ok := obj.(*Commit)
+		if !ok {
+			return false, fmt.Errorf("%s is not a commit", h)
+		}
+		stack = append(stack, commit.Parents...)
+	}
+	return false, nil
+}
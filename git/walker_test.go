@@ -0,0 +1,110 @@
+package git
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fixtureWalkerObjects(t *testing.T) (objects map[string]Object, tag *Tag, first, second *Commit) {
+	blob, tree, first := fixtureFsckObjects(t)
+	second = &Commit{}
+	err := second.SetBytes([]byte(fmt.Sprintf("tree %x\nparent %x\nauthor A U Thor <author@example.com> 1400000001 +0000\ncommitter A U Thor <author@example.com> 1400000001 +0000\n\nSecond commit\n", tree.Hash(), first.Hash())))
+	if err != nil {
+		t.Errorf("error while decoding commit: %v", err)
+	}
+	tag = &Tag{}
+	err = tag.SetBytes([]byte(fmt.Sprintf("object %x\ntype commit\ntag v1\ntagger A U Thor <author@example.com> 1400000001 +0000\n\nFirst release\n", second.Hash())))
+	if err != nil {
+		t.Errorf("error while decoding tag: %v", err)
+	}
+	objects = make(map[string]Object)
+	for _, obj := range []Object{blob, tree, first, second, tag} {
+		objects[string(obj.Hash())] = obj
+	}
+	return
+}
+
+func walk(t *testing.T, w *Walker, tips ...Hash) (types []string) {
+	err := w.Walk(tips, func(obj Object) error {
+		types = append(types, obj.Type())
+		return nil
+	})
+	assert.Nil(t, err)
+	return
+}
+
+func TestWalker(t *testing.T) {
+	objects, tag, first, second := fixtureWalkerObjects(t)
+	read := func(h Hash) (Object, error) {
+		if obj, ok := objects[string(h)]; ok {
+			return obj, nil
+		}
+		return nil, fmt.Errorf("missing object %s", h)
+	}
+
+	// the tree and blob are shared by both commits but visited once
+	assert.Equal(t, walk(t, NewWalker(read), tag.Hash()), []string{"tag", "commit", "tree", "blob", "commit"})
+
+	w := NewWalker(read)
+	w.Hide(first.Hash())
+	assert.Equal(t, walk(t, w, second.Hash()), []string{"commit", "tree", "blob"})
+	assert.True(t, w.Visited(first.Hash()))
+	assert.Nil(t, walk(t, w, second.Hash()))
+
+	w = NewWalker(read)
+	w.Shallow[string(second.Hash())] = true
+	assert.Equal(t, walk(t, w, second.Hash()), []string{"commit", "tree", "blob"})
+
+	w = NewWalker(read)
+	w.Filter = func(obj Object, depth int) bool { return obj.Type() != "blob" }
+	assert.Equal(t, walk(t, w, second.Hash()), []string{"commit", "tree", "commit"})
+	// filtered out objects are not visited
+	assert.Equal(t, walk(t, w, objects[string(first.Tree)].(*Tree).Entries[0].Hash), []string{"blob"})
+
+	delete(objects, string(first.Hash()))
+	assert.NotNil(t, NewWalker(read).Walk([]Hash{second.Hash()}, nil))
+}
+
+func TestWalkerSkipsGitlinks(t *testing.T) {
+	blob, _, _ := fixtureFsckObjects(t)
+	tree := &Tree{}
+	tree.SetBytes(append([]byte("160000 submodule\x00"), blob.Hash()...))
+	w := NewWalker(func(h Hash) (Object, error) {
+		if h.String() == Hash(tree.Hash()).String() {
+			return tree, nil
+		}
+		return nil, fmt.Errorf("missing object %s", h)
+	})
+	assert.Equal(t, walk(t, w, tree.Hash()), []string{"tree"})
+}
+
+func TestIsAncestor(t *testing.T) {
+	objects, tag, first, second := fixtureWalkerObjects(t)
+	read := func(h Hash) (Object, error) {
+		if obj, ok := objects[string(h)]; ok {
+			return obj, nil
+		}
+		return nil, fmt.Errorf("missing object %s", h)
+	}
+
+	for _, c := range []struct {
+		ancestor, descendant Hash
+		expected             bool
+	}{
+		{first.Hash(), second.Hash(), true},
+		{second.Hash(), second.Hash(), true},
+		{second.Hash(), first.Hash(), false},
+	} {
+		ok, err := IsAncestor(read, c.ancestor, c.descendant)
+		assert.Nil(t, err)
+		assert.Equal(t, ok, c.expected)
+	}
+
+	_, err := IsAncestor(read, first.Hash(), tag.Hash())
+	assert.NotNil(t, err)
+	delete(objects, string(first.Hash()))
+	_, err = IsAncestor(read, tag.Hash(), second.Hash())
+	assert.NotNil(t, err)
+}
@@ -5,15 +5,20 @@ import (
 	"crypto/ecdsa"
 	"crypto/rand"
 	"encoding/gob"
+	"errors"
+	"fmt"
 	"math/big"
 
 	"code.google.com/p/go.crypto/ripemd160"
 
 	"github.com/conformal/btcec"
 	"github.com/spx/gitchain/util"
-	"github.com/tv42/base58"
 )
 
+// ADDRESS_VERSION is the version byte of Gitchain addresses, which makes
+// them start with a G
+const ADDRESS_VERSION = 0x26
+
 // For now, ECDSA keys generated by Gitchain use the P-256 curve
 // There are different opinions about what curves to use:
 //
@@ -52,40 +57,107 @@ func DecodeECDSAPrivateKey(b []byte) (*ecdsa.PrivateKey, error) {
 	return privateKey, nil
 }
 
+// Hash160 returns the RIPEMD-160 hash of the SHA-256 hash of b
+func Hash160(b []byte) []byte {
+	h := ripemd160.New()
+	h.Write(util.SHA256(b))
+	return h.Sum(nil)
+}
+
+// ECDSAPublicKeyToString returns the Base58Check address of a public key:
+// ADDRESS_VERSION, the Hash160 of its compressed encoding and the first 4
+// bytes of the double SHA-256 hash of both
 func ECDSAPublicKeyToString(key ecdsa.PublicKey) string {
-	x := key.X.Bytes()
-	y := key.Y.Bytes()
-	sha := util.SHA256(append(append([]byte{0x04}, x...), y...)) // should it be 0x04?
-	ripe := ripemd160.New().Sum(sha)
-	ripesha := util.SHA256(ripe)
-	ripedoublesha := util.SHA256(ripesha)
-	head := ripedoublesha[0:3]
-	final := append(ripe, head...)
-	i := new(big.Int)
-	i.SetBytes(final)
-	var b []byte
-	return string(base58.EncodeBig(b, i))
+	enc, err := EncodeECDSAPublicKey(&key)
+	if err != nil {
+		return ""
+	}
+	payload := append([]byte{ADDRESS_VERSION}, Hash160(enc)...)
+	return base58Encode(append(payload, addressChecksum(payload)...))
 }
 
-func EncodeECDSAPublicKey(key *ecdsa.PublicKey) ([]byte, error) {
-	buf := new(bytes.Buffer)
-	enc := gob.NewEncoder(buf)
-	err := enc.Encode([]big.Int{*key.X, *key.Y})
+func addressChecksum(payload []byte) []byte {
+	return util.SHA256(util.SHA256(payload))[0:4]
+}
+
+// ParseAddress returns the public key hash an address was derived from
+func ParseAddress(address string) ([]byte, error) {
+	b, err := base58Decode(address)
 	if err != nil {
 		return nil, err
 	}
-	return buf.Bytes(), nil
+	if len(b) != 25 {
+		return nil, errors.New("malformed address")
+	}
+	if b[0] != ADDRESS_VERSION {
+		return nil, fmt.Errorf("unsupported address version %d", b[0])
+	}
+	if bytes.Compare(addressChecksum(b[0:21]), b[21:]) != 0 {
+		return nil, errors.New("address checksum mismatch")
+	}
+	return b[1:21], nil
 }
 
+// ValidAddress tells whether an address is well formed
+func ValidAddress(address string) bool {
+	_, err := ParseAddress(address)
+	return err == nil
+}
+
+// EncodeECDSAPublicKey encodes a public key as a compressed SEC1 point:
+// 0x02 (even Y) or 0x03 (odd Y) followed by X as a 32-byte big-endian
+// integer
+func EncodeECDSAPublicKey(key *ecdsa.PublicKey) ([]byte, error) {
+	if key.X.BitLen() > 256 || key.Y.BitLen() > 256 {
+		return nil, errors.New("public key coordinates are too large")
+	}
+	b := make([]byte, 33)
+	b[0] = 0x02 + byte(key.Y.Bit(0))
+	x := key.X.Bytes()
+	copy(b[33-len(x):], x)
+	return b, nil
+}
+
+// DecodeECDSAPublicKey decodes a compressed SEC1 point, as well as an
+// uncompressed one (0x04 followed by X and Y), which is how public keys
+// were encoded before
 func DecodeECDSAPublicKey(b []byte) (*ecdsa.PublicKey, error) {
-	var p []big.Int
-	buf := bytes.NewBuffer(b)
-	dec := gob.NewDecoder(buf)
-	err := dec.Decode(&p)
+	curve := btcec.S256()
+	key := &ecdsa.PublicKey{Curve: curve}
+	switch {
+	case len(b) == 33 && (b[0] == 0x02 || b[0] == 0x03):
+		key.X = new(big.Int).SetBytes(b[1:])
+		if key.X.Cmp(curve.P) >= 0 {
+			return nil, errors.New("public key is not on the curve")
+		}
+		// y^2 = x^3 + 7, and as P = 3 mod 4, y = (y^2)^((P+1)/4)
+		y2 := new(big.Int).Exp(key.X, big.NewInt(3), curve.P)
+		y2.Add(y2, curve.B).Mod(y2, curve.P)
+		exp := new(big.Int).Rsh(new(big.Int).Add(curve.P, big.NewInt(1)), 2)
+		key.Y = new(big.Int).Exp(y2, exp, curve.P)
+		if key.Y.Bit(0) != uint(b[0]&1) {
+			key.Y.Sub(curve.P, key.Y)
+		}
+	case len(b) == 65 && b[0] == 0x04:
+		key.X = new(big.Int).SetBytes(b[1:33])
+		key.Y = new(big.Int).SetBytes(b[33:])
+	default:
+		return nil, errors.New("malformed public key")
+	}
+	if !curve.IsOnCurve(key.X, key.Y) {
+		return nil, errors.New("public key is not on the curve")
+	}
+	return key, nil
+}
+
+// NormalizeECDSAPublicKey re-encodes an encoded public key in the current
+// (compressed) encoding
+func NormalizeECDSAPublicKey(b []byte) ([]byte, error) {
+	key, err := DecodeECDSAPublicKey(b)
 	if err != nil {
 		return nil, err
 	}
-	return &ecdsa.PublicKey{Curve: btcec.S256(), X: &p[0], Y: &p[1]}, nil
+	return EncodeECDSAPublicKey(key)
 }
 
 func EqualECDSAPrivateKeys(k1, k2 *ecdsa.PrivateKey) (bool, error) {
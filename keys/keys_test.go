@@ -1,8 +1,13 @@
 package keys
 
 import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"math/big"
 	"testing"
 
+	"github.com/conformal/btcec"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -41,6 +46,86 @@ func TestEncodeDecodeECDSAPublicKey(t *testing.T) {
 
 }
 
+func TestEncodeECDSAPublicKeyGoldenVector(t *testing.T) {
+	// the generator of secp256k1, which is the public key of the private key 1
+	curve := btcec.S256()
+	key := &ecdsa.PublicKey{Curve: curve, X: curve.Gx, Y: curve.Gy}
+	encoded, err := EncodeECDSAPublicKey(key)
+	assert.Nil(t, err)
+	assert.Equal(t, hex.EncodeToString(encoded), "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	key1, err := DecodeECDSAPublicKey(encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, key1, key)
+
+	// its opposite has an odd Y
+	opposite := &ecdsa.PublicKey{Curve: curve, X: curve.Gx, Y: new(big.Int).Sub(curve.P, curve.Gy)}
+	encoded, err = EncodeECDSAPublicKey(opposite)
+	assert.Nil(t, err)
+	assert.Equal(t, hex.EncodeToString(encoded), "0379be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	key1, err = DecodeECDSAPublicKey(encoded)
+	assert.Nil(t, err)
+	assert.Equal(t, key1, opposite)
+
+	// X is padded to 32 bytes
+	small := &ecdsa.PublicKey{Curve: curve, X: big.NewInt(1), Y: big.NewInt(2)}
+	encoded, err = EncodeECDSAPublicKey(small)
+	assert.Nil(t, err)
+	assert.Equal(t, len(encoded), 33)
+
+	_, err = DecodeECDSAPublicKey(encoded[0:32])
+	assert.NotNil(t, err)
+	encoded[0] = 0x06 // hybrid encodings aren't supported
+	_, err = DecodeECDSAPublicKey(encoded)
+	assert.NotNil(t, err)
+}
+
+func TestDecodeUncompressedECDSAPublicKey(t *testing.T) {
+	curve := btcec.S256()
+	uncompressed, _ := hex.DecodeString("0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")
+	key, err := DecodeECDSAPublicKey(uncompressed)
+	assert.Nil(t, err)
+	assert.Equal(t, key, &ecdsa.PublicKey{Curve: curve, X: curve.Gx, Y: curve.Gy})
+
+	normalized, err := NormalizeECDSAPublicKey(uncompressed)
+	assert.Nil(t, err)
+	assert.Equal(t, hex.EncodeToString(normalized), "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+
+	uncompressed[64] ^= 1 // not on the curve anymore
+	_, err = DecodeECDSAPublicKey(uncompressed)
+	assert.NotNil(t, err)
+	_, err = NormalizeECDSAPublicKey(uncompressed)
+	assert.NotNil(t, err)
+}
+
+func TestAddressGoldenVector(t *testing.T) {
+	curve := btcec.S256()
+	key := ecdsa.PublicKey{Curve: curve, X: curve.Gx, Y: curve.Gy}
+	address := ECDSAPublicKeyToString(key)
+	assert.Equal(t, address, "GUXByHDZLvU4DnVH9imSFckt3HEQ5cFgE5")
+	hash, err := ParseAddress(address)
+	assert.Nil(t, err)
+	assert.Equal(t, hex.EncodeToString(hash), "751e76e8199196d454941c45d1b3a323f1433bd6")
+	assert.True(t, ValidAddress(address))
+
+	// Bitcoin addresses have another version
+	assert.False(t, ValidAddress("1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH"))
+	// a typo
+	assert.False(t, ValidAddress("GUXByHDZLvU4DnVH9imSFckt3HEQ5cFgE6"))
+	// a character outside of the alphabet
+	assert.False(t, ValidAddress("GUXByHDZLvU4DnVH9imSFckt3HEQ5cFgE0"))
+	assert.False(t, ValidAddress(""))
+}
+
+func TestBase58(t *testing.T) {
+	for _, b := range [][]byte{{}, {0}, {0, 0, 1}, {0x61}, {0xff, 0xff}} {
+		decoded, err := base58Decode(base58Encode(b))
+		assert.Nil(t, err)
+		assert.Equal(t, decoded, b)
+	}
+	assert.Equal(t, base58Encode([]byte{0, 0, 1}), "112")
+	assert.Equal(t, base58Encode([]byte("hello world")), "StV1DL6CwTryKyV")
+}
+
 func TestECDSAPrivateKeyEquality(t *testing.T) {
 	key, err := GenerateECDSA()
 	if err != nil {
@@ -11,10 +11,12 @@ import (
 	"os"
 
 	"github.com/alecthomas/kingpin"
+	"github.com/spx/gitchain/repository"
 	"github.com/spx/gitchain/server"
 	"github.com/spx/gitchain/server/api"
 	"github.com/spx/gitchain/server/config"
 	"github.com/spx/gitchain/server/context"
+	gitserver "github.com/spx/gitchain/server/git"
 	httpserver "github.com/spx/gitchain/server/http"
 	netserver "github.com/spx/gitchain/server/net"
 
@@ -35,11 +37,21 @@ func jsonrpc(cfg *config.T, method string, req, res interface{}) error {
 	return nil
 }
 
+// shortHash abbreviates a hash the way git does
+func shortHash(h string) string {
+	if len(h) < 7 {
+		return h
+	}
+	return h[0:7]
+}
+
 func main() {
 	var configFile, dataPath, assets, netHostname string
 	var httpPort, netPort int
 
-	var alias, repo, random, hash, node string
+	var alias, repo, random, hash, node, file, branch, grace, ref, path string
+	var off, dryRun bool
+	var limit int
 
 	app := kingpin.New("gitchain", "Gitchain daemon and command line interface")
 	app.Flag("config", "configuration file").Short('c').ExistingFileVar(&configFile)
@@ -57,6 +69,14 @@ func main() {
 
 	app.Command("keypair-list", "Lists all keypairs")
 
+	signingKeyPublish := app.Command("signing-key-publish", "Submits a Signing Key Transaction for an OpenPGP public key")
+	signingKeyPublish.Arg("alias", "Keypair to publish the signing key with").Required().StringVar(&alias)
+	signingKeyPublish.Arg("file", "Armored OpenPGP public key (gpg --export --armor)").Required().ExistingFileVar(&file)
+
+	sshKeyAuthorize := app.Command("ssh-key-authorize", "Authorizes an SSH key to push on behalf of a keypair")
+	sshKeyAuthorize.Arg("alias", "Keypair signing the pushes made with the SSH key").Required().StringVar(&alias)
+	sshKeyAuthorize.Arg("file", "SSH public key (such as ~/.ssh/id_ed25519.pub)").Required().ExistingFileVar(&file)
+
 	nameReservation := app.Command("name-reservation", "Submits a Name Reservation Transaction")
 	nameReservation.Arg("alias", "Keypair name to save it under").Required().StringVar(&alias)
 	nameReservation.Arg("name", "Repository name to reserve").Required().StringVar(&repo)
@@ -68,6 +88,43 @@ func main() {
 
 	app.Command("repo-list", "Lists all repositories")
 
+	repoDefaultBranch := app.Command("repo-default-branch", "Submits a Default Branch Transaction")
+	repoDefaultBranch.Arg("alias", "Keypair the repository name was allocated with").Required().StringVar(&alias)
+	repoDefaultBranch.Arg("name", "Repository name").Required().StringVar(&repo)
+	repoDefaultBranch.Arg("branch", "Branch HEAD should point to").Required().StringVar(&branch)
+
+	repoProtectBranch := app.Command("repo-protect-branch", "Submits a Branch Protection Transaction")
+	repoProtectBranch.Flag("off", "Lift the protection instead").BoolVar(&off)
+	repoProtectBranch.Arg("alias", "Keypair the repository name was allocated with").Required().StringVar(&alias)
+	repoProtectBranch.Arg("name", "Repository name").Required().StringVar(&repo)
+	repoProtectBranch.Arg("branch", "Branch that can't be deleted (nor rewound through nodes enforcing it)").Required().StringVar(&branch)
+
+	repoTags := app.Command("repo-tags", "Lists the tags of a repository")
+	repoTags.Arg("name", "Repository name").Required().StringVar(&repo)
+
+	repoRefs := app.Command("repo-refs", "Lists the references of a repository")
+	repoRefs.Arg("name", "Repository name").Required().StringVar(&repo)
+
+	repoTree := app.Command("repo-tree", "Lists a directory of a repository")
+	repoTree.Flag("ref", "Branch, tag or reference (HEAD by default)").StringVar(&ref)
+	repoTree.Arg("name", "Repository name").Required().StringVar(&repo)
+	repoTree.Arg("path", "Directory (the root directory by default)").StringVar(&path)
+
+	repoShow := app.Command("repo-show", "Prints a file of a repository")
+	repoShow.Flag("ref", "Branch, tag or reference (HEAD by default)").StringVar(&ref)
+	repoShow.Arg("name", "Repository name").Required().StringVar(&repo)
+	repoShow.Arg("path", "File").Required().StringVar(&path)
+
+	repoLog := app.Command("repo-log", "Lists the commits of a repository")
+	repoLog.Flag("ref", "Branch, tag or reference (HEAD by default)").StringVar(&ref)
+	repoLog.Flag("limit", "Maximum number of commits").Short('n').IntVar(&limit)
+	repoLog.Arg("name", "Repository name").Required().StringVar(&repo)
+
+	refLog := app.Command("ref-log", "Lists the confirmed updates of a reference")
+	refLog.Flag("limit", "Maximum number of updates").Short('n').IntVar(&limit)
+	refLog.Arg("name", "Repository name").Required().StringVar(&repo)
+	refLog.Arg("ref", "Branch, tag or reference (HEAD by default)").StringVar(&ref)
+
 	block := app.Command("block", "Renders a block")
 	block.Arg("block", "Block hash").Required().StringVar(&hash)
 
@@ -79,6 +136,13 @@ func main() {
 	transaction := app.Command("transaction", "Renders a transaction")
 	transaction.Arg("txn", "Transaction hash").Required().StringVar(&hash)
 
+	pushStatus := app.Command("push-status", "Tells whether the references of a push have been updated")
+	pushStatus.Arg("txn", "Transaction hash printed by git push").Required().StringVar(&hash)
+
+	gc := app.Command("gc", "Removes the objects no repository can reach")
+	gc.Flag("grace", "Keep unreachable objects stored within this period (such as 336h)").StringVar(&grace)
+	gc.Flag("dry-run", "Only report what would be removed").BoolVar(&dryRun)
+
 	app.Command("info", "Returns gitchain node information")
 
 	join := app.Command("node-join", "Connect to another node")
@@ -167,6 +231,36 @@ func main() {
 				}
 			}(), resp.Aliases[i])
 		}
+	case "signing-key-publish":
+		key, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Printf("Can't read signing key because of %v\n", err)
+			os.Exit(1)
+		}
+		var resp api.PublishSigningKeyReply
+		err = jsonrpc(cfg, "KeyService.PublishSigningKey", &api.PublishSigningKeyArgs{Alias: alias, Key: string(key)}, &resp)
+		if err != nil {
+			fmt.Printf("Can't publish signing key because of %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Signing key has been submitted (%s)\n", resp.Id)
+	case "ssh-key-authorize":
+		key, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Printf("Can't read SSH key because of %v\n", err)
+			os.Exit(1)
+		}
+		var resp api.AuthorizeSSHKeyReply
+		err = jsonrpc(cfg, "KeyService.AuthorizeSSHKey", &api.AuthorizeSSHKeyArgs{Alias: alias, Key: string(key)}, &resp)
+		if err != nil {
+			fmt.Printf("Can't authorize SSH key because of %v\n", err)
+			os.Exit(1)
+		}
+		if !resp.Success {
+			fmt.Printf("Server can't authorize the SSH key\n")
+			os.Exit(1)
+		}
+		fmt.Printf("SSH key has been authorized to push as %s\n", alias)
 	case "name-reservation":
 		var resp api.NameReservationReply
 		err := jsonrpc(cfg, "NameService.NameReservation", &api.NameReservationArgs{Alias: alias, Name: repo}, &resp)
@@ -191,7 +285,90 @@ func main() {
 			os.Exit(1)
 		}
 		for i := range resp.Repositories {
-			fmt.Printf("%s %s %s\n", resp.Repositories[i].Name, resp.Repositories[i].Status, resp.Repositories[i].NameAllocationTx)
+			fmt.Printf("%s %s %s %s\n", resp.Repositories[i].Name, resp.Repositories[i].Status, resp.Repositories[i].NameAllocationTx, resp.Repositories[i].DefaultBranch)
+		}
+	case "repo-default-branch":
+		var resp api.SetDefaultBranchReply
+		err := jsonrpc(cfg, "RepositoryService.SetDefaultBranch", &api.SetDefaultBranchArgs{Alias: alias, Repository: repo, Branch: branch}, &resp)
+		if err != nil {
+			fmt.Printf("Can't change the default branch because of %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Default branch change for %s has been submitted (%s)\n", repo, resp.Id)
+	case "repo-protect-branch":
+		var resp api.ProtectBranchReply
+		err := jsonrpc(cfg, "RepositoryService.ProtectBranch", &api.ProtectBranchArgs{Alias: alias, Repository: repo, Branch: branch, Protected: !off}, &resp)
+		if err != nil {
+			fmt.Printf("Can't change the branch protection because of %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Branch protection change for %s has been submitted (%s)\n", repo, resp.Id)
+	case "repo-tags":
+		var resp api.ListTagsReply
+		err := jsonrpc(cfg, "RepositoryService.ListTags", &api.ListTagsArgs{Repository: repo}, &resp)
+		if err != nil {
+			fmt.Printf("Can't list tags because of %v\n", err)
+			os.Exit(1)
+		}
+		for i := range resp.Tags {
+			fmt.Printf("%s %s %s", resp.Tags[i].Object, resp.Tags[i].ObjectType, resp.Tags[i].Name)
+			if resp.Tags[i].Tagger != "" {
+				fmt.Printf(" (%s)", resp.Tags[i].Tagger)
+			}
+			fmt.Println()
+		}
+	case "repo-refs":
+		var resp api.ListRefsReply
+		err := jsonrpc(cfg, "RepositoryService.ListRefs", &api.ListRefsArgs{Repository: repo}, &resp)
+		if err != nil {
+			fmt.Printf("Can't list references because of %v\n", err)
+			os.Exit(1)
+		}
+		for i := range resp.Refs {
+			fmt.Printf("%s %s", resp.Refs[i].Object, resp.Refs[i].Name)
+			if resp.Refs[i].Transaction != "" {
+				fmt.Printf(" (%s)", resp.Refs[i].Transaction)
+			}
+			fmt.Println()
+		}
+	case "repo-tree":
+		var resp api.GetTreeReply
+		err := jsonrpc(cfg, "RepositoryService.GetTree", &api.GetTreeArgs{Repository: repo, Ref: ref, Path: path}, &resp)
+		if err != nil {
+			fmt.Printf("Can't list directory because of %v\n", err)
+			os.Exit(1)
+		}
+		for i := range resp.Entries {
+			fmt.Printf("%06s %s %s\t%s\n", resp.Entries[i].Mode, resp.Entries[i].Type, resp.Entries[i].Object, resp.Entries[i].Name)
+		}
+	case "repo-show":
+		var resp api.GetBlobReply
+		err := jsonrpc(cfg, "RepositoryService.GetBlob", &api.GetBlobArgs{Repository: repo, Ref: ref, Path: path}, &resp)
+		if err != nil {
+			fmt.Printf("Can't read file because of %v\n", err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(resp.Content)
+	case "repo-log":
+		var resp api.LogReply
+		err := jsonrpc(cfg, "RepositoryService.Log", &api.LogArgs{Repository: repo, Ref: ref, Limit: limit}, &resp)
+		if err != nil {
+			fmt.Printf("Can't list commits because of %v\n", err)
+			os.Exit(1)
+		}
+		for i := range resp.Commits {
+			fmt.Printf("commit %s\nAuthor: %s\n\n%s\n", resp.Commits[i].Hash, resp.Commits[i].Author, resp.Commits[i].Message)
+		}
+	case "ref-log":
+		var resp api.RefHistoryReply
+		err := jsonrpc(cfg, "RepositoryService.RefHistory", &api.RefHistoryArgs{Repository: repo, Ref: ref, Limit: limit}, &resp)
+		if err != nil {
+			fmt.Printf("Can't retrieve reference history because of %v\n", err)
+			os.Exit(1)
+		}
+		for _, e := range resp.Entries {
+			fmt.Printf("%s %s..%s block %d (%s) by %s txn %s\n", time.Unix(e.Timestamp, 0).UTC().Format(time.RFC3339),
+				shortHash(e.Old), shortHash(e.New), e.Height, e.Block, e.Signer, e.Transaction)
 		}
 	case "block-last":
 		var resp api.GetLastBlockReply
@@ -231,6 +408,37 @@ func main() {
 		fmt.Printf("Previous transaction hash: %v\nPublic key: %v\nNext public key: %v\nValid: %v\n%+v\n",
 			resp.PreviousTransactionHash, resp.PublicKey, resp.NextPublicKey, resp.Valid,
 			resp.Content)
+	case "push-status":
+		var resp api.GetRefUpdateStatusReply
+		err := jsonrpc(cfg, "TransactionService.GetRefUpdateStatus", &api.GetRefUpdateStatusArgs{Hash: hash}, &resp)
+		if err != nil {
+			fmt.Printf("Can't retrieve push status because of %v\n", err)
+			os.Exit(1)
+		}
+		switch {
+		case resp.Status == repository.REF_UPDATE_APPLIED:
+			fmt.Printf("Applied (%d confirmations)\n", resp.Confirmations)
+		case resp.Status != "":
+			fmt.Printf("Rejected: %s\n", resp.Status)
+			os.Exit(1)
+		case resp.Confirmations > 0:
+			fmt.Printf("Pending (%d confirmations)\n", resp.Confirmations)
+		default:
+			fmt.Printf("Pending (not included in a block yet)\n")
+		}
+	case "gc":
+		var resp api.GCReply
+		err := jsonrpc(cfg, "ObjectService.GC", &api.GCArgs{GracePeriod: grace, DryRun: dryRun}, &resp)
+		if err != nil {
+			fmt.Printf("Can't collect garbage because of %v\n", err)
+			os.Exit(1)
+		}
+		verb := "Removed"
+		if dryRun {
+			verb = "Would remove"
+		}
+		fmt.Printf("%s %d unreachable objects (%d bytes)\n", verb, resp.Removed, resp.Freed)
+		fmt.Printf("Kept %d reachable and %d recent unreachable objects\n", resp.Reachable, resp.Recent)
 	case "info":
 		resp, err := http.Get(fmt.Sprintf("http://localhost:%d/info", cfg.API.HttpPort))
 		if err != nil {
@@ -258,11 +466,14 @@ func main() {
 			log.Printf("Error during server initialization: %v", err) // don't use log15 here
 			os.Exit(1)
 		}
+		gitserver.RegisterHook(gitserver.NewExecHook(srv))
 		go netserver.Server(srv)
 		go server.NameRegistrar(srv)
 		go server.RepositoryServer(srv)
 		go server.MiningFactory(srv)
 		go server.TransactionListener(srv)
+		go gitserver.Daemon(srv)
+		go gitserver.SSH(srv)
 		httpserver.Server(srv)
 	}
 }
@@ -13,18 +13,97 @@ const (
 	ACTIVE  = 1
 )
 
+// REF_UPDATE_APPLIED is the status of reference update transactions
+// that were applied, others being rejected for the reason given in
+// their status
+const REF_UPDATE_APPLIED = "applied"
+
+// DEFAULT_BRANCH is the branch HEAD points to unless the repository
+// owner chose another one
+const DEFAULT_BRANCH = "master"
+
 type Ref []byte
 
+// RefUpdate moves a reference from Old to New
+type RefUpdate struct {
+	Ref string
+	Old Ref
+	New Ref
+}
+
+// RefLogEntry records a reference update applied by a confirmed
+// transaction
+type RefLogEntry struct {
+	Ref         string
+	Old         Ref
+	New         Ref
+	Transaction types.Hash
+	Signer      []byte // encoded public key of the transaction
+	Block       types.Hash
+	Height      int   // of the block, the genesis block being at 0
+	Timestamp   int64 // of the block
+}
+
+func (e *RefLogEntry) Encode() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	err := enc.Encode(e)
+	return buf.Bytes(), err
+}
+
+func DecodeRefLogEntry(encoded []byte) (*RefLogEntry, error) {
+	var e RefLogEntry
+	dec := gob.NewDecoder(bytes.NewBuffer(encoded))
+	err := dec.Decode(&e)
+	return &e, err
+}
+
 type T struct {
 	Name             string
 	Status           int
 	NameAllocationTx types.Hash
+	DefaultBranch    string // empty for DEFAULT_BRANCH
+	// branches that can't be deleted or updated to
+	// a commit not descending from their current one
+	ProtectedBranches []string
 }
 
 func NewRepository(name string, status int, alloc types.Hash) *T {
 	return &T{Name: name, Status: status, NameAllocationTx: alloc}
 }
 
+// Head returns the reference HEAD points to
+func (t *T) Head() string {
+	if t.DefaultBranch == "" {
+		return "refs/heads/" + DEFAULT_BRANCH
+	}
+	return "refs/heads/" + t.DefaultBranch
+}
+
+// Protected tells whether ref is a protected branch
+func (t *T) Protected(ref string) bool {
+	for i := range t.ProtectedBranches {
+		if ref == "refs/heads/"+t.ProtectedBranches[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// SetProtected adds a branch to or removes it from the protected branches
+func (t *T) SetProtected(branch string, protected bool) {
+	branches := []string{}
+	for i := range t.ProtectedBranches {
+		if t.ProtectedBranches[i] != branch {
+			branches = append(branches, t.ProtectedBranches[i])
+		}
+	}
+	if protected {
+		branches = append(branches, branch)
+	}
+	t.ProtectedBranches = branches
+}
+
 func (t *T) Encode() ([]byte, error) {
 	var buf bytes.Buffer
 	enc := gob.NewEncoder(&buf)
@@ -16,5 +16,6 @@ func JsonRpcService(srv *context.T, log log15.Logger) *rpc.Server {
 	s.RegisterService(&TransactionService{srv: srv, log: log}, "")
 	s.RegisterService(&RepositoryService{srv: srv, log: log}, "")
 	s.RegisterService(&NetService{srv: srv, log: log}, "")
+	s.RegisterService(&ObjectService{srv: srv, log: log}, "")
 	return s
 }
@@ -1,11 +1,17 @@
 package api
 
 import (
+	"bytes"
+	"encoding/hex"
+	"errors"
 	"net/http"
 
+	"code.google.com/p/go.crypto/openpgp"
+	"code.google.com/p/go.crypto/ssh"
 	"github.com/inconshreveable/log15"
 	"github.com/spx/gitchain/keys"
 	"github.com/spx/gitchain/server/context"
+	"github.com/spx/gitchain/transaction"
 )
 
 // KeySerice
@@ -100,3 +106,70 @@ func (service *KeyService) GetMainKey(r *http.Request, args *GetMainKeyArgs, rep
 	}
 	return nil
 }
+
+type PublishSigningKeyArgs struct {
+	Alias string
+	Key   string // armored OpenPGP public key
+}
+
+type PublishSigningKeyReply struct {
+	Id string
+}
+
+// PublishSigningKey submits a Signing Key Transaction linking a commit
+// signing key to a keypair
+func (service *KeyService) PublishSigningKey(r *http.Request, args *PublishSigningKeyArgs, reply *PublishSigningKeyReply) error {
+	log := service.log.New("cmp", "api_key")
+	key, err := service.srv.DB.GetKey(args.Alias)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return errors.New("can't find the key")
+	}
+	if _, err := openpgp.ReadArmoredKeyRing(bytes.NewBufferString(args.Key)); err != nil {
+		return err
+	}
+	tx := transaction.NewSigningKey([]byte(args.Key))
+
+	hash, err := service.srv.DB.GetPreviousEnvelopeHashForPublicKey(&key.PublicKey)
+	if err != nil {
+		log.Error("error while preparing transaction", "err", err)
+	}
+	txe := transaction.NewEnvelope(hash, tx)
+	txe.Sign(key)
+
+	reply.Id = hex.EncodeToString(txe.Hash())
+	service.srv.Router.Pub(txe, "/transaction")
+	return nil
+}
+
+type AuthorizeSSHKeyArgs struct {
+	Alias string
+	Key   string // authorized_keys line
+}
+
+type AuthorizeSSHKeyReply struct {
+	Success bool
+}
+
+// AuthorizeSSHKey lets the holder of an SSH key push over SSH, their
+// reference updates being signed with the keypair stored under alias
+func (service *KeyService) AuthorizeSSHKey(r *http.Request, args *AuthorizeSSHKeyArgs, reply *AuthorizeSSHKeyReply) error {
+	key, err := service.srv.DB.GetKey(args.Alias)
+	if err != nil {
+		return err
+	}
+	if key == nil {
+		return errors.New("can't find the key")
+	}
+	sshKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(args.Key))
+	if err != nil {
+		return err
+	}
+	if err = service.srv.DB.PutSSHKey(sshKey.Marshal(), args.Alias); err != nil {
+		return err
+	}
+	reply.Success = true
+	return nil
+}
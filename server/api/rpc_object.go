@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spx/gitchain/server/context"
+	"github.com/spx/gitchain/server/objects"
+)
+
+type ObjectService struct {
+	srv *context.T
+	log log15.Logger
+}
+
+type GCArgs struct {
+	GracePeriod string // such as "336h", defaults to objects.GC_GRACE_PERIOD
+	DryRun      bool
+}
+
+type GCReply struct {
+	Reachable int
+	Recent    int
+	Removed   int
+	Freed     int64
+}
+
+// GC removes the stored objects that aren't reachable from any repository
+func (service *ObjectService) GC(r *http.Request, args *GCArgs, reply *GCReply) error {
+	grace := objects.GC_GRACE_PERIOD
+	if args.GracePeriod != "" {
+		var err error
+		if grace, err = time.ParseDuration(args.GracePeriod); err != nil {
+			return err
+		}
+	}
+	report, err := objects.GC(service.srv, grace, args.DryRun)
+	if report != nil {
+		*reply = GCReply(*report)
+	}
+	if err != nil {
+		service.log.Error("error while collecting garbage", "err", err)
+		return err
+	}
+	service.log.Info("collected garbage", "removed", report.Removed, "freed", report.Freed, "dry_run", args.DryRun)
+	return nil
+}
@@ -2,17 +2,29 @@ package api
 
 import (
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/inconshreveable/log15"
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/keys"
 	"github.com/spx/gitchain/repository"
 	"github.com/spx/gitchain/server/context"
+	"github.com/spx/gitchain/server/objects"
+	"github.com/spx/gitchain/transaction"
 )
 
+// repo describes a repository in replies. Like those of the other reply
+// types, its fields are exported to be JSON encoded, and the gitchain
+// command and git-remote-gitchain read them.
 type repo struct {
 	Name             string
 	Status           string
 	NameAllocationTx string
+	DefaultBranch    string
+	Protected        []string // protected branches
 }
 
 type RepositoryService struct {
@@ -43,7 +55,427 @@ func (service *RepositoryService) ListRepositories(r *http.Request, args *ListRe
 			repo{
 				Name:             r.Name,
 				Status:           status[r.Status],
-				NameAllocationTx: hex.EncodeToString(r.NameAllocationTx)})
+				NameAllocationTx: hex.EncodeToString(r.NameAllocationTx),
+				DefaultBranch:    strings.TrimPrefix(r.Head(), "refs/heads/"),
+				Protected:        r.ProtectedBranches})
+	}
+	return nil
+}
+
+type GetRepositoryArgs struct {
+	Name string
+}
+
+type GetRepositoryReply struct {
+	Repository *repo // nil if the name hasn't been allocated
+}
+
+func (service *RepositoryService) GetRepository(r *http.Request, args *GetRepositoryArgs, reply *GetRepositoryReply) error {
+	r1, err := service.srv.DB.GetRepository(args.Name)
+	if err != nil {
+		return err
+	}
+	if r1 != nil {
+		reply.Repository = &repo{
+			Name:             r1.Name,
+			Status:           status[r1.Status],
+			NameAllocationTx: hex.EncodeToString(r1.NameAllocationTx),
+			DefaultBranch:    strings.TrimPrefix(r1.Head(), "refs/heads/"),
+			Protected:        r1.ProtectedBranches}
+	}
+	return nil
+}
+
+type SetDefaultBranchArgs struct {
+	Alias      string
+	Repository string
+	Branch     string
+}
+
+type SetDefaultBranchReply struct {
+	Id string
+}
+
+// SetDefaultBranch submits a Default Branch Transaction, which only takes
+// effect if the keypair is the one the repository name was allocated with
+func (service *RepositoryService) SetDefaultBranch(r *http.Request, args *SetDefaultBranchArgs, reply *SetDefaultBranchReply) error {
+	tx := transaction.NewDefaultBranch(args.Repository, strings.TrimPrefix(args.Branch, "refs/heads/"))
+	if !tx.Valid() {
+		return fmt.Errorf("invalid branch name %s", args.Branch)
+	}
+	id, err := service.publish(args.Alias, tx)
+	reply.Id = id
+	return err
+}
+
+type ProtectBranchArgs struct {
+	Alias      string
+	Repository string
+	Branch     string
+	Protected  bool
+}
+
+type ProtectBranchReply struct {
+	Id string
+}
+
+// ProtectBranch submits a Branch Protection Transaction, which only takes
+// effect if the keypair is the one the repository name was allocated with
+func (service *RepositoryService) ProtectBranch(r *http.Request, args *ProtectBranchArgs, reply *ProtectBranchReply) error {
+	tx := transaction.NewBranchProtection(args.Repository, strings.TrimPrefix(args.Branch, "refs/heads/"), args.Protected)
+	if !tx.Valid() {
+		return fmt.Errorf("invalid branch name %s", args.Branch)
+	}
+	id, err := service.publish(args.Alias, tx)
+	reply.Id = id
+	return err
+}
+
+// publish signs a transaction with the key stored under alias and
+// submits it, returning its envelope hash
+func (service *RepositoryService) publish(alias string, tx transaction.T) (string, error) {
+	log := service.log.New("cmp", "api_repository")
+	key, err := service.srv.DB.GetKey(alias)
+	if err != nil {
+		return "", err
+	}
+	if key == nil {
+		return "", errors.New("can't find the key")
+	}
+
+	hash, err := service.srv.DB.GetPreviousEnvelopeHashForPublicKey(&key.PublicKey)
+	if err != nil {
+		log.Error("error while preparing transaction", "err", err)
+	}
+	txe := transaction.NewEnvelope(hash, tx)
+	txe.Sign(key)
+
+	service.srv.Router.Pub(txe, "/transaction")
+	return hex.EncodeToString(txe.Hash()), nil
+}
+
+type tag struct {
+	Name       string
+	Object     string
+	ObjectType string
+	Tagger     string // empty for lightweight tags
+	Message    string
+	Signed     bool
+}
+
+type ListTagsArgs struct {
+	Repository string
+}
+
+type ListTagsReply struct {
+	Tags []tag
+}
+
+func (service *RepositoryService) ListTags(r *http.Request, args *ListTagsArgs, reply *ListTagsReply) error {
+	log := service.log.New("cmp", "api_repository")
+	refs, err := service.srv.DB.ListRefs(args.Repository)
+	if err != nil {
+		return err
+	}
+	for i := range refs {
+		if !strings.HasPrefix(refs[i], "refs/tags/") {
+			continue
+		}
+		ref, err := service.srv.DB.GetRef(args.Repository, refs[i])
+		if err != nil {
+			return err
+		}
+		t := tag{Name: strings.TrimPrefix(refs[i], "refs/tags/"), Object: hex.EncodeToString(ref)}
+		obj, err := objects.Read(service.srv, git.Hash(ref))
+		if err != nil {
+			log.Error("error while reading tag", "ref", refs[i], "err", err)
+			return err
+		}
+		if annotated, ok := obj.(*git.Tag); ok {
+			t.Object = hex.EncodeToString(annotated.Object)
+			t.ObjectType = annotated.ObjectType
+			t.Tagger = annotated.Tagger
+			t.Message = annotated.Message
+			t.Signed = annotated.Signature != ""
+		} else {
+			t.ObjectType = obj.Type()
+		}
+		reply.Tags = append(reply.Tags, t)
+	}
+	return nil
+}
+
+// refCandidates returns the references ref may stand for, ref being HEAD
+// (or nothing), a full reference name or a branch or tag name
+func refCandidates(r *repository.T, ref string) []string {
+	switch {
+	case ref == "" || ref == "HEAD":
+		return []string{r.Head()}
+	case strings.HasPrefix(ref, "refs/"):
+		return []string{ref}
+	}
+	return []string{"refs/heads/" + ref, "refs/tags/" + ref}
+}
+
+// resolveRef returns what a reference points to
+func (service *RepositoryService) resolveRef(name, ref string) (git.Hash, error) {
+	r, err := service.srv.DB.GetRepository(name)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, fmt.Errorf("unknown repository %s", name)
+	}
+	candidates := refCandidates(r, ref)
+	for i := range candidates {
+		h, err := service.srv.DB.GetRef(name, candidates[i])
+		if err != nil {
+			return nil, err
+		}
+		if !h.Equals(repository.EmptyRef()) {
+			return git.Hash(h), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown reference %s", ref)
+}
+
+// read reads the objects of the repositories being browsed
+func (service *RepositoryService) read(h git.Hash) (git.Object, error) {
+	return objects.Read(service.srv, h)
+}
+
+type ref struct {
+	Name        string
+	Object      string
+	Transaction string // (batch) reference update that set it, if known
+}
+
+type ListRefsArgs struct {
+	Repository string
+}
+
+type ListRefsReply struct {
+	Head string
+	Refs []ref
+}
+
+// ListRefs lists the references of a repository along with the
+// transactions that set them
+func (service *RepositoryService) ListRefs(r *http.Request, args *ListRefsArgs, reply *ListRefsReply) error {
+	r1, err := service.srv.DB.GetRepository(args.Repository)
+	if err != nil {
+		return err
+	}
+	if r1 == nil {
+		return fmt.Errorf("unknown repository %s", args.Repository)
+	}
+	reply.Head = r1.Head()
+	refs, err := service.srv.DB.ListRefs(args.Repository)
+	if err != nil {
+		return err
+	}
+	for i := range refs {
+		h, err := service.srv.DB.GetRef(args.Repository, refs[i])
+		if err != nil {
+			return err
+		}
+		txn, err := service.srv.DB.GetRefTransaction(args.Repository, refs[i])
+		if err != nil {
+			return err
+		}
+		reply.Refs = append(reply.Refs, ref{Name: refs[i], Object: hex.EncodeToString(h), Transaction: hex.EncodeToString(txn)})
+	}
+	return nil
+}
+
+type treeEntry struct {
+	Name   string
+	Mode   string
+	Type   string
+	Object string
+}
+
+type GetTreeArgs struct {
+	Repository string
+	Ref        string // HEAD if empty
+	Path       string // root directory if empty
+}
+
+type GetTreeReply struct {
+	Tree    string
+	Entries []treeEntry
+}
+
+// GetTree lists a directory of the commit a reference points to
+func (service *RepositoryService) GetTree(r *http.Request, args *GetTreeArgs, reply *GetTreeReply) error {
+	h, err := service.resolveRef(args.Repository, args.Ref)
+	if err != nil {
+		return err
+	}
+	commit, err := git.PeelToCommit(service.read, h)
+	if err != nil {
+		return err
+	}
+	obj, err := git.LookupPath(service.read, commit.Tree, args.Path)
+	if err != nil {
+		return err
+	}
+	tree, ok := obj.(*git.Tree)
+	if !ok {
+		return fmt.Errorf("%s is not a directory", args.Path)
+	}
+	reply.Tree = hex.EncodeToString(tree.Hash())
+	for _, e := range tree.Entries {
+		typ := "blob"
+		switch e.Mode {
+		case "40000", "040000":
+			typ = "tree"
+		case "160000":
+			typ = "commit"
+		}
+		reply.Entries = append(reply.Entries, treeEntry{Name: e.File, Mode: e.Mode, Type: typ, Object: hex.EncodeToString(e.Hash)})
+	}
+	return nil
+}
+
+type GetBlobArgs struct {
+	Repository string
+	Ref        string // HEAD if empty
+	Path       string
+}
+
+type GetBlobReply struct {
+	Blob    string
+	Content []byte
+}
+
+// GetBlob returns a file of the commit a reference points to
+func (service *RepositoryService) GetBlob(r *http.Request, args *GetBlobArgs, reply *GetBlobReply) error {
+	h, err := service.resolveRef(args.Repository, args.Ref)
+	if err != nil {
+		return err
+	}
+	commit, err := git.PeelToCommit(service.read, h)
+	if err != nil {
+		return err
+	}
+	obj, err := git.LookupPath(service.read, commit.Tree, args.Path)
+	if err != nil {
+		return err
+	}
+	blob, ok := obj.(*git.Blob)
+	if !ok {
+		return fmt.Errorf("%s is not a file", args.Path)
+	}
+	reply.Blob = hex.EncodeToString(blob.Hash())
+	reply.Content = blob.Content
+	return nil
+}
+
+type commit struct {
+	Hash      string
+	Tree      string
+	Parents   []string
+	Author    string
+	Committer string
+	Message   string
+}
+
+type LogArgs struct {
+	Repository string
+	Ref        string // HEAD if empty
+	Limit      int    // all commits if not positive
+}
+
+type LogReply struct {
+	Commits []commit
+}
+
+// Log lists the commits reachable from a reference, most recent first
+func (service *RepositoryService) Log(r *http.Request, args *LogArgs, reply *LogReply) error {
+	h, err := service.resolveRef(args.Repository, args.Ref)
+	if err != nil {
+		return err
+	}
+	commits, err := git.Log(service.read, h, args.Limit)
+	if err != nil {
+		return err
+	}
+	for _, c := range commits {
+		var parents []string
+		for i := range c.Parents {
+			parents = append(parents, hex.EncodeToString(c.Parents[i]))
+		}
+		reply.Commits = append(reply.Commits, commit{
+			Hash:      hex.EncodeToString(c.Hash()),
+			Tree:      hex.EncodeToString(c.Tree),
+			Parents:   parents,
+			Author:    c.Author,
+			Committer: c.Committer,
+			Message:   c.Message})
+	}
+	return nil
+}
+
+type refLogEntry struct {
+	Old         string
+	New         string
+	Transaction string
+	Signer      string
+	Block       string
+	Height      int
+	Timestamp   int64
+}
+
+type RefHistoryArgs struct {
+	Repository string
+	Ref        string // HEAD if empty
+	Limit      int    // all entries if not positive
+}
+
+type RefHistoryReply struct {
+	Ref     string
+	Entries []refLogEntry // most recent first
+}
+
+// RefHistory lists the confirmed updates of a reference, which may have
+// been deleted since
+func (service *RepositoryService) RefHistory(r *http.Request, args *RefHistoryArgs, reply *RefHistoryReply) error {
+	r1, err := service.srv.DB.GetRepository(args.Repository)
+	if err != nil {
+		return err
+	}
+	if r1 == nil {
+		return fmt.Errorf("unknown repository %s", args.Repository)
+	}
+	candidates := refCandidates(r1, args.Ref)
+	var entries []*repository.RefLogEntry
+	for i := range candidates {
+		if entries, err = service.srv.DB.GetRefLog(args.Repository, candidates[i]); err != nil {
+			return err
+		}
+		reply.Ref = candidates[i]
+		if len(entries) > 0 {
+			break
+		}
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if args.Limit > 0 && len(reply.Entries) == args.Limit {
+			break
+		}
+		e := entries[i]
+		signer := hex.EncodeToString(e.Signer)
+		if pk, err := keys.DecodeECDSAPublicKey(e.Signer); err == nil {
+			signer = keys.ECDSAPublicKeyToString(*pk)
+		}
+		reply.Entries = append(reply.Entries, refLogEntry{
+			Old:         e.Old.String(),
+			New:         e.New.String(),
+			Transaction: hex.EncodeToString(e.Transaction),
+			Signer:      signer,
+			Block:       hex.EncodeToString(e.Block),
+			Height:      e.Height,
+			Timestamp:   e.Timestamp})
 	}
 	return nil
 }
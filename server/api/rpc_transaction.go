@@ -74,3 +74,29 @@ func (service *TransactionService) GetTransaction(r *http.Request, args *GetTran
 	reply.Content = string(jsonEncoded)
 	return nil
 }
+
+type GetRefUpdateStatusArgs struct {
+	Hash string
+}
+
+type GetRefUpdateStatusReply struct {
+	Confirmations int    // 0 if the transaction isn't included in a block yet
+	Status        string // empty until the update is applied or rejected
+}
+
+// GetRefUpdateStatus tells whether the references pushed in a (batch)
+// reference update transaction have been updated
+func (service *TransactionService) GetRefUpdateStatus(r *http.Request, args *GetRefUpdateStatusArgs, reply *GetRefUpdateStatusReply) error {
+	hash, err := hex.DecodeString(args.Hash)
+	if err != nil {
+		return err
+	}
+	if _, err := service.srv.DB.GetTransactionBlock(hash); err == nil {
+		reply.Confirmations, err = service.srv.DB.GetTransactionConfirmations(hash)
+		if err != nil {
+			return err
+		}
+	}
+	reply.Status, err = service.srv.DB.GetRefUpdateStatus(hash)
+	return err
+}
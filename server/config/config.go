@@ -15,9 +15,20 @@ type T struct {
 		DevelopmentModeAssets string `gcfg:"development-mode-assets"`
 	}
 	Network struct {
-		Port     int
-		Hostname string
-		Join     []string
+		Port          int
+		Hostname      string
+		Join          []string
+		ObjectTimeout int `gcfg:"object-timeout"` // seconds
+		Replicas      int // number of nodes storing each object
+		// seconds between proof-of-storage challenges, 0 to disable them
+		ChallengeInterval int `gcfg:"challenge-interval"`
+	}
+	Git struct {
+		DaemonPort int `gcfg:"daemon-port"` // git:// protocol, 0 to disable it
+		SSHPort    int `gcfg:"ssh-port"`    // 0 to disable it
+		// repositories only accepting commits and tags signed by their
+		// owner's published signing keys
+		SignedRepositories []string `gcfg:"signed-repository"`
 	}
 	Mining struct {
 		Processes int
@@ -29,6 +40,11 @@ func Default() (cfg *T) {
 	cfg.General.DataPath = "gitchain.db"
 	cfg.API.HttpPort = 3000
 	cfg.Network.Port = 31000
+	cfg.Network.ObjectTimeout = 10
+	cfg.Network.Replicas = 3
+	cfg.Network.ChallengeInterval = 60
+	cfg.Git.DaemonPort = 9418
+	cfg.Git.SSHPort = 2222
 	cfg.Mining.Processes = runtime.NumCPU()
 	return
 }
@@ -0,0 +1,94 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/bargez/pktline"
+	"github.com/inconshreveable/log15"
+	"github.com/spx/gitchain/server/context"
+)
+
+// Daemon serves repositories over the git:// protocol. Only fetching is
+// supported, like git daemon does by default.
+func Daemon(srv *context.T) {
+	log := srv.Log.New("cmp", "git-daemon")
+	if srv.Config.Git.DaemonPort == 0 {
+		return
+	}
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", srv.Config.Git.DaemonPort))
+	if err != nil {
+		log.Error("can't listen", "port", srv.Config.Git.DaemonPort, "err", err)
+		return
+	}
+	log.Info("listening", "port", srv.Config.Git.DaemonPort)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Error("error while accepting connection", "err", err)
+			continue
+		}
+		go serveDaemonConnection(srv, conn, log)
+	}
+}
+
+// serveDaemonConnection handles a "<service> /<repository>\0host=<host>\0"
+// request, possibly followed by extra parameters ("\0version=2\0")
+func serveDaemonConnection(srv *context.T, conn net.Conn, log log15.Logger) {
+	defer conn.Close()
+	dec := pktline.NewDecoder(conn)
+	enc := pktline.NewEncoder(conn)
+
+	var line []byte
+	if err := dec.Decode(&line); err != nil {
+		if err != io.EOF {
+			log.Error("error while reading request", "addr", conn.RemoteAddr(), "err", err)
+		}
+		return
+	}
+	fields := bytes.Split(line, []byte{0})
+	request := strings.SplitN(strings.TrimSuffix(string(fields[0]), "\n"), " ", 2)
+	if len(request) != 2 {
+		enc.Encode([]byte(fmt.Sprintf("ERR malformed request %q\n", fields[0])))
+		return
+	}
+	version := 0
+	for _, param := range fields[1:] {
+		if string(param) == "version=2" {
+			version = 2
+		}
+	}
+	if request[0] != "git-upload-pack" {
+		enc.Encode([]byte(fmt.Sprintf("ERR service %s not enabled\n", request[0])))
+		return
+	}
+
+	reponame := strings.TrimPrefix(request[1], "/")
+	log = log.New("repo", reponame, "addr", conn.RemoteAddr())
+	active, err := activeRepository(srv, reponame)
+	if err != nil {
+		log.Error("error while retrieving repository", "err", err)
+		enc.Encode([]byte("ERR internal error\n"))
+		return
+	}
+	if !active {
+		enc.Encode([]byte(fmt.Sprintf("ERR repository %s not found\n", reponame)))
+		return
+	}
+
+	if version == 2 {
+		advertiseV2(conn)
+		for uploadPackV2(srv, reponame, conn, conn, log) {
+		}
+		return
+	}
+	if err := advertiseRefs(srv, reponame, conn); err != nil {
+		log.Error("error listing refs", "err", err)
+		enc.Encode([]byte("ERR internal error\n"))
+		return
+	}
+	uploadPack(srv, reponame, conn, conn, false, log)
+}
@@ -0,0 +1,34 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/server/context"
+)
+
+// The dumb HTTP protocol lets clients fetch by downloading info/refs and
+// then every object they miss, one by one, from objects/xx/yyyy. All
+// objects are stored loose, so objects/info/packs is always empty.
+
+// dumbRefs lists the references of a repository the way info/refs files
+// do, annotated tags being followed by the object they point to
+func dumbRefs(srv *context.T, reponame string) ([]byte, error) {
+	refs, err := srv.DB.ListRefs(reponame)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	for i := range refs {
+		ref, err := srv.DB.GetRef(reponame, refs[i])
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "%s\t%s\n", git.Hash(ref), refs[i])
+		if peeled, ok := peel(srv, git.Hash(ref)); ok {
+			fmt.Fprintf(&buf, "%s\t%s^{}\n", peeled, refs[i])
+		}
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,68 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spx/gitchain/git"
+)
+
+// objectFilter leaves objects out of a packfile for partial clones
+type objectFilter struct {
+	// blobs of at least this size are omitted, -1 for no limit
+	blobLimit int64
+	// trees and blobs at least this deep (the root tree being at depth
+	// 0) are omitted, -1 for no limit
+	treeDepth int
+}
+
+// parseFilter parses a filter-spec as sent by git (blob:none,
+// blob:limit=<n>[kmg] or tree:<depth>)
+func parseFilter(spec string) (*objectFilter, error) {
+	filter := &objectFilter{blobLimit: -1, treeDepth: -1}
+	switch {
+	case spec == "blob:none":
+		filter.blobLimit = 0
+	case strings.HasPrefix(spec, "blob:limit="):
+		limit := strings.ToLower(strings.TrimPrefix(spec, "blob:limit="))
+		var unit int64 = 1
+		switch {
+		case strings.HasSuffix(limit, "k"):
+			unit = 1024
+		case strings.HasSuffix(limit, "m"):
+			unit = 1024 * 1024
+		case strings.HasSuffix(limit, "g"):
+			unit = 1024 * 1024 * 1024
+		}
+		if unit != 1 {
+			limit = limit[0 : len(limit)-1]
+		}
+		n, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid filter-spec %q", spec)
+		}
+		filter.blobLimit = n * unit
+	case strings.HasPrefix(spec, "tree:"):
+		n, err := strconv.Atoi(strings.TrimPrefix(spec, "tree:"))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid filter-spec %q", spec)
+		}
+		filter.treeDepth = n
+	default:
+		return nil, fmt.Errorf("unsupported filter-spec %q", spec)
+	}
+	return filter, nil
+}
+
+// allow tells whether an object found depth levels down a commit's tree
+// is to be sent
+func (f *objectFilter) allow(obj git.Object, depth int) bool {
+	if f == nil {
+		return true
+	}
+	if blob, ok := obj.(*git.Blob); ok && f.blobLimit >= 0 && int64(len(blob.Bytes())) >= f.blobLimit {
+		return false
+	}
+	return f.treeDepth < 0 || depth < f.treeDepth
+}
@@ -2,12 +2,13 @@ package git
 
 import (
 	"bytes"
+	"compress/zlib"
+	"crypto/ecdsa"
 	"encoding/hex"
 	"fmt"
 	"io"
-	"io/ioutil"
+	"net"
 	"net/http"
-	"path"
 	"strings"
 
 	"github.com/bargez/pktline"
@@ -16,7 +17,7 @@ import (
 	"github.com/spx/gitchain/git"
 	"github.com/spx/gitchain/repository"
 	"github.com/spx/gitchain/server/context"
-	"github.com/spx/gitchain/transaction"
+	"github.com/spx/gitchain/server/objects"
 )
 
 func pktlineToBytes(b []byte) []byte {
@@ -27,76 +28,47 @@ func pktlineToBytes(b []byte) []byte {
 	return buf.Bytes()
 }
 
-func readObject(srv *context.T, h git.Hash) (b []byte, err error) {
-	hash := []byte(hex.EncodeToString(h))
-	hd := hash[0:2]
-	tl := hash[2:]
-	b, err = ioutil.ReadFile(path.Join(srv.Config.General.DataPath, "objects", string(hd), string(tl)))
-	if err != nil {
-		err = fmt.Errorf("object %s is unretrievable: %v", h, err)
-		return
-	}
-	return
+type command struct {
+	old, new git.Hash
+	ref      string
 }
 
-func processTree(srv *context.T, h git.Hash, haves []git.Hash) (objs []git.Object, err error) {
-	b, err := readObject(srv, h)
-	if err != nil {
+// parseCommand parses a receive-pack "<old> <new> <ref>" line, ignoring
+// capabilities that may follow the reference name
+func parseCommand(line []byte) (cmd command, err error) {
+	line = bytes.TrimRight(bytes.SplitN(line, []byte{0}, 2)[0], "\n")
+	split := strings.Split(string(line), " ")
+	if len(split) != 3 {
+		err = fmt.Errorf("Malformed command %s", line)
 		return
 	}
-	tree := git.DecodeObject(b).(*git.Tree)
-	objs = append(objs, tree)
-	for i := range tree.Entries {
-		entry := tree.Entries[i]
-		var objects []git.Object
-		b, err = readObject(srv, entry.Hash)
-		if err != nil {
-			return
-		}
-		obj := git.DecodeObject(b)
-		switch obj.Type() {
-		case "commit":
-			objects, err = processCommit(srv, entry.Hash, haves)
-		case "tree":
-			objects, err = processTree(srv, entry.Hash, haves)
-		case "blob":
-			objects = []git.Object{obj}
-		case "tag":
-			objects = []git.Object{obj}
-		}
-		if err != nil {
-			return
-		}
-		objs = append(objs, objects...)
-	}
-	return
-}
-func processCommit(srv *context.T, want git.Hash, haves []git.Hash) (objs []git.Object, err error) {
-	for i := range haves {
-		if bytes.Compare(want, haves[i]) == 0 {
-			return
-		}
-	}
-	b, err := readObject(srv, want)
+	cmd.old, err = hex.DecodeString(split[0])
 	if err != nil {
+		err = fmt.Errorf("Malformed hash %s", split[0])
 		return
 	}
-	commit := git.DecodeObject(b).(*git.Commit)
-	objs = append(objs, commit)
-	tree, err := processTree(srv, commit.Tree, haves)
+	cmd.new, err = hex.DecodeString(split[1])
 	if err != nil {
+		err = fmt.Errorf("Malformed hash %s", split[1])
 		return
 	}
-	objs = append(objs, tree...)
-	for i := range commit.Parents {
-		var objects []git.Object
-		objects, err = processCommit(srv, commit.Parents[i], haves)
-		if err != nil {
-			return
+	cmd.ref = split[2]
+	return
+}
+
+// hasCapability tells whether the first line of a request, where
+// capabilities follow a NUL byte, lists a capability
+func hasCapability(line []byte, capability string) bool {
+	split := bytes.SplitN(bytes.TrimRight(line, "\n"), []byte{0}, 2)
+	if len(split) < 2 {
+		return false
+	}
+	for _, c := range strings.Fields(string(split[1])) {
+		if c == capability {
+			return true
 		}
-		objs = append(objs, objects...)
 	}
-	return
+	return false
 }
 
 type pktlineWriter struct {
@@ -109,236 +81,95 @@ func (w *pktlineWriter) Write(p []byte) (n int, err error) {
 	return
 }
 
-type sideband64Writer struct {
+// sidebandWriter splits the data written into packets of
+// no more than max bytes sent over a side-band channel
+type sidebandWriter struct {
 	writer io.Writer
 	band   byte
+	max    int
 }
 
-func (w *sideband64Writer) Write(p []byte) (n int, err error) {
-	var n1 int
-	if len(p) > 65519 {
-		portions := len(p) / 65519
-		for i := 0; i < portions; i++ {
-			n1, err = w.writer.Write(append([]byte{w.band}, p[i*65519:65519]...))
-			if err != nil {
-				return n + n1, err
-			}
-			n += n1
-			n1 = 0
+func (w *sidebandWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		sz := len(p)
+		if sz > w.max {
+			sz = w.max
 		}
-		if len(p)%65119 > 0 {
-			n1, err = w.writer.Write(append([]byte{w.band}, p[portions*65519:]...))
-			if err != nil {
-				return n + n1, err
-			}
-			n += n1
-			n1 = 0
+		if _, err = w.writer.Write(append([]byte{w.band}, p[0:sz]...)); err != nil {
+			return
 		}
-		return n, nil
-	} else {
-		return w.writer.Write(append([]byte{w.band}, p...))
+		n += sz
+		p = p[sz:]
 	}
+	return
 }
 
 func SetupGitRoutes(r *mux.Router, srv *context.T, log log15.Logger) {
 	log = log.New("cmp", "git")
 	// Git Server
 	r.Methods("POST").Path("/{repository:.+}/git-upload-pack").HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
-		log := log.New("cmp", "git-upload-pack")
-		dec := pktline.NewDecoder(req.Body)
 		resp.Header().Add("Cache-Control", "no-cache")
 		resp.Header().Add("Content-Type", "application/x-git-upload-pack-result")
-		enc := pktline.NewEncoder(resp)
-
-		var wants, haves, common []git.Hash
-		var objects []git.Object
-		wantsRcvd := false
-
-		for {
-			var pktline []byte
-			if err := dec.Decode(&pktline); err != nil {
-				log.Error("error while decoding pkt-line", "err", err)
-				return
-			}
-
-			switch {
-			case pktline == nil:
-				switch {
-				case !wantsRcvd:
-					wantsRcvd = true
-				case wantsRcvd:
-					for i := range haves {
-						_, err := readObject(srv, haves[i])
-						if err == nil {
-							enc.Encode([]byte(fmt.Sprintf("ACK %x common\n", haves[i])))
-							common = append(common, haves[i])
-						} else {
-							enc.Encode([]byte("NAK\n"))
-						}
-					}
-					haves = make([]git.Hash, 0)
-				}
-			case bytes.Compare(pktline, []byte("done\n")) == 0:
-				if len(common) == 0 {
-					enc.Encode([]byte("NAK\n"))
-				}
-				goto done
-			default:
-				line := bytes.Split(pktline, []byte{' '})
-				h := bytes.TrimSuffix(line[1], []byte{10})
-				hash, err := hex.DecodeString(string(h))
-				if err != nil {
-					enc.Encode(append([]byte{3}, []byte(fmt.Sprintf("error parsing hash %s: %v\n", line[1], err))...))
-					return
-				}
-				if string(line[0]) == "want" {
-					wants = append(wants, hash)
-				}
-				if string(line[0]) == "have" {
-					haves = append(haves, hash)
-				}
-			}
-		}
-	done:
-		var err error
-		for i := range wants {
-			var objs []git.Object
-			objs, err = processCommit(srv, wants[i], common)
-			if err != nil {
-				enc.Encode(append([]byte{3}, []byte(fmt.Sprintf("%s", err))...))
-				return
-			}
-			objects = append(objects, objs...)
-		}
-		// filter out duplicates
-		seen := make(map[string]bool)
-		filteredObjects := make([]git.Object, 0)
-		for i := range objects {
-			hash := string(objects[i].Hash())
-			if !seen[hash] {
-				seen[hash] = true
-				filteredObjects = append(filteredObjects, objects[i])
-			}
-		}
-		//
-
-		packfile := git.NewPackfile(filteredObjects)
-		err = git.WritePackfile(&sideband64Writer{writer: &pktlineWriter{encoder: enc}, band: 1}, packfile)
-		if err != nil {
-			enc.Encode(append([]byte{3}, []byte(fmt.Sprintf("%s", err))...))
+		if protocolVersion(req) == 2 {
+			uploadPackV2(srv, mux.Vars(req)["repository"], req.Body, resp, log.New("cmp", "git-upload-pack"))
 			return
 		}
-
-		enc.Encode(append([]byte{1}, pktlineToBytes(nil)...))
-		enc.Encode(nil)
+		uploadPack(srv, mux.Vars(req)["repository"], req.Body, resp, true, log.New("cmp", "git-upload-pack"))
 	})
 
 	r.Methods("POST").Path("/{repository:.+}/git-receive-pack").HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
-		reponame := mux.Vars(req)["repository"]
-		var lines [][]byte
-		dec := pktline.NewDecoder(req.Body)
-		dec.DecodeUntilFlush(&lines)
+		key, ok := httpPusherKey(srv, resp, req, log)
+		if !ok {
+			return
+		}
 		resp.Header().Add("Cache-Control", "no-cache")
 		resp.Header().Add("Content-Type", "application/x-git-receive-pack-result")
-		enc := pktline.NewEncoder(resp)
-
-		packfile, err := git.ReadPackfile(req.Body)
-		if err != nil {
-			enc.Encode(append([]byte{1}, pktlineToBytes([]byte(fmt.Sprintf("unpack %v\n", err)))...))
-		} else {
-			enc.Encode(append([]byte{1}, pktlineToBytes([]byte("unpack ok"))...))
-			for i := range packfile.Objects {
-				err = git.WriteObject(packfile.Objects[i], path.Join(srv.Config.General.DataPath, "objects"))
-				if err != nil {
-					enc.Encode(append([]byte{3}, []byte(fmt.Sprintf("Error while writing object: %v\n", err))...))
-				} else {
-					srv.Router.Pub(packfile.Objects[i], "/git/object")
-				}
-			}
-			for i := range lines {
-				split := strings.Split(string(lines[i]), " ")
-				old := split[0]
-				new := split[1]
-				ref := strings.TrimRight(split[2], string([]byte{0}))
-				oldHash, err := hex.DecodeString(old)
-				if err != nil {
-					enc.Encode(append([]byte{3}, []byte(fmt.Sprintf("Malformed hash %s\n", old))...))
-					return
-				}
-				newHash, err := hex.DecodeString(new)
-				if err != nil {
-					enc.Encode(append([]byte{3}, []byte(fmt.Sprintf("Malformed hash %s\n", new))...))
-					return
-				}
-				tx := transaction.NewReferenceUpdate(reponame, ref, oldHash, newHash)
-				key, err := srv.DB.GetMainKey()
-				if err != nil {
-					enc.Encode(append([]byte{3}, []byte(fmt.Sprintf("Errow while retrieving main key: %v", err))...))
-					return
-				}
-				if key == nil {
-					enc.Encode(append([]byte{3}, []byte("No main private key to sign the transaction")...))
-					return
-				}
-				hash, err := srv.DB.GetPreviousEnvelopeHashForPublicKey(&key.PublicKey)
-				if err != nil {
-					enc.Encode(append([]byte{3}, []byte(fmt.Sprintf("Error while preparing transaction: %v", err))...))
-					return
-				}
-
-				txe := transaction.NewEnvelope(hash, tx)
-				txe.Sign(key)
-
-				enc.Encode(append([]byte{2}, []byte(fmt.Sprintf("[gitchain] Transaction %s\n", txe.Hash()))...))
-				srv.Router.Pub(txe, "/transaction")
-				enc.Encode(append([]byte{1}, pktlineToBytes([]byte(fmt.Sprintf("ok %s\n", ref)))...))
-			}
-		}
-		enc.Encode(append([]byte{1}, pktlineToBytes(nil)...))
-		enc.Encode(nil)
+		receivePack(srv, mux.Vars(req)["repository"], req.Body, resp, key, log.New("cmp", "git-receive-pack"))
 	})
 
 	r.Methods("GET").Path("/{repository:.+}/info/refs").HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
 		req.ParseForm()
-		service := req.Form["service"][0]
+		service := req.Form.Get("service")
 
 		reponame := mux.Vars(req)["repository"]
-		repo, err := srv.DB.GetRepository(reponame)
+		active, err := activeRepository(srv, reponame)
 		if err != nil {
 			log.Error("error while retrieving repository", "repo", reponame, "err", err)
 			resp.WriteHeader(500)
 			return
 		}
-		if repo == nil || repo.Status == repository.PENDING {
+		if !active {
 			resp.WriteHeader(404)
 			return
 		}
-		refs, err := srv.DB.ListRefs(reponame)
-		if err != nil {
-			log.Error("error listing refs", "repo", reponame, "err", err)
-			resp.WriteHeader(500)
-			return
+		if service == "git-receive-pack" {
+			if _, ok := httpPusherKey(srv, resp, req, log); !ok {
+				return
+			}
 		}
-		reflines := make([][]byte, len(refs))
-		for i := range refs {
-			ref, err := srv.DB.GetRef(reponame, refs[i])
+		if service == "" {
+			refs, err := dumbRefs(srv, reponame)
 			if err != nil {
-				log.Error("error getting ref", "repo", reponame, "err", err)
+				log.Error("error listing refs", "repo", reponame, "err", err)
 				resp.WriteHeader(500)
 				return
 			}
-			refline := append(append([]byte(hex.EncodeToString(ref)), 32), []byte(refs[i])...)
-			if i == 0 {
-				// append capabilities
-				refline = append(append(refline, 0), capabilities()...)
-			}
-			refline = append(refline, 10) // LF
-			reflines[i] = refline
+			resp.Header().Add("Content-Type", "text/plain; charset=utf-8")
+			resp.Header().Add("Cache-Control", "no-cache")
+			resp.Write(refs)
+			return
 		}
-
-		ref, err := srv.DB.GetRef(reponame, "refs/heads/master")
-		if bytes.Compare(ref, make([]byte, 20)) != 0 {
-			reflines = append(reflines, append(append(append([]byte(hex.EncodeToString(ref)), 32), []byte("HEAD")...), 10))
+		if service == "git-upload-pack" && protocolVersion(req) == 2 {
+			resp.Header().Add("Content-Type", fmt.Sprintf("application/x-%s-advertisement", service))
+			resp.Header().Add("Cache-Control", "no-cache")
+			advertiseV2(resp)
+			return
+		}
+		reflines, err := refAdvertisement(srv, reponame)
+		if err != nil {
+			log.Error("error listing refs", "repo", reponame, "err", err)
+			resp.WriteHeader(500)
+			return
 		}
 
 		resp.Header().Add("Content-Type", fmt.Sprintf("application/x-%s-advertisement", service))
@@ -346,19 +177,25 @@ func SetupGitRoutes(r *mux.Router, srv *context.T, log log15.Logger) {
 		enc := pktline.NewEncoder(resp)
 		enc.Encode([]byte(fmt.Sprintf("# service=%s\n", service)))
 		enc.Encode(nil)
-		if len(reflines) == 0 {
-			enc.Encode(append(append(append(append([]byte("0000000000000000000000000000000000000000"), 32), nulCapabilities()...), []byte{0, 32, 10}...)))
-		} else {
-			for i := range reflines {
-				enc.Encode(reflines[i])
-			}
+		for i := range reflines {
+			enc.Encode(reflines[i])
 		}
 		enc.Encode(nil)
 	})
 
 	r.Methods("GET").Path("/{repository:.+}/HEAD").HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
 		reponame := mux.Vars(req)["repository"]
-		ref, err := srv.DB.GetRef(reponame, "refs/heads/master")
+		active, err := activeRepository(srv, reponame)
+		if err != nil {
+			log.Error("error while retrieving repository", "repo", reponame, "err", err)
+			resp.WriteHeader(500)
+			return
+		}
+		if !active {
+			resp.WriteHeader(404)
+			return
+		}
+		head, err := headRef(srv, reponame)
 		if err != nil {
 			log.Error("error while retrieving repository HEAD", "repo", reponame, "err", err)
 			resp.WriteHeader(500)
@@ -366,18 +203,149 @@ func SetupGitRoutes(r *mux.Router, srv *context.T, log log15.Logger) {
 		}
 		resp.Header().Add("Content-Type", "text/plain")
 		resp.Header().Add("Cache-Control", "no-cache")
-		resp.Write([]byte(hex.EncodeToString(ref)))
+		resp.Write([]byte("ref: " + head + "\n"))
+	})
+
+	r.Methods("GET").Path("/{repository:.+}/objects/info/packs").HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.Header().Add("Content-Type", "text/plain; charset=utf-8")
+		resp.Header().Add("Cache-Control", "no-cache")
 	})
 
-	r.Methods("GET").Path("/{repository:.+}/objects/{hash:.+}").HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+	r.Methods("GET").Path("/{repository:.+}/objects/{prefix:[0-9a-f]{2}}/{suffix:[0-9a-f]{38}}").HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		vars := mux.Vars(req)
+		active, err := activeRepository(srv, vars["repository"])
+		if err != nil {
+			log.Error("error while retrieving repository", "repo", vars["repository"], "err", err)
+			resp.WriteHeader(500)
+			return
+		}
+		if !active {
+			resp.WriteHeader(404)
+			return
+		}
+		h, _ := hex.DecodeString(vars["prefix"] + vars["suffix"])
+		if ok, err := reachable(srv, vars["repository"], h); !ok {
+			if err != nil {
+				log.Error("error while checking object reachability", "repo", vars["repository"], "obj", git.Hash(h), "err", err)
+			}
+			resp.WriteHeader(404)
+			return
+		}
+		obj, err := objects.Read(srv, h)
+		if err != nil {
+			resp.WriteHeader(404)
+			return
+		}
+		resp.Header().Add("Content-Type", "application/x-git-loose-object")
+		resp.Header().Add("Cache-Control", "public, max-age=31536000") // objects never change
+		zw := zlib.NewWriter(resp)
+		zw.Write(git.ObjectToBytes(obj))
+		zw.Close()
 	})
 
 }
 
-func nulCapabilities() []byte {
-	return append(append([]byte("capabilities^{}"), 0), capabilities()...)
+// httpPusherKey returns the key to sign a push received over HTTP with,
+// replying with an error and returning false if there is none. HTTP
+// doesn't identify pushers, so only pushes from the node's own host, that
+// is by its operator, are signed with the node's main key; anybody else
+// has to push over SSH.
+func httpPusherKey(srv *context.T, resp http.ResponseWriter, req *http.Request, log log15.Logger) (*ecdsa.PrivateKey, bool) {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+		resp.WriteHeader(403)
+		resp.Write([]byte("Pushing over HTTP is only allowed from the node's host, push over SSH instead\n"))
+		return nil, false
+	}
+	key, err := srv.DB.GetMainKey()
+	if err != nil {
+		log.Error("error while retrieving main key", "err", err)
+		resp.WriteHeader(500)
+		return nil, false
+	}
+	if key == nil {
+		resp.WriteHeader(403)
+		resp.Write([]byte("No private key to sign the transaction\n"))
+		return nil, false
+	}
+	return key, true
+}
+
+// activeRepository tells whether a repository can be served
+func activeRepository(srv *context.T, reponame string) (bool, error) {
+	repo, err := srv.DB.GetRepository(reponame)
+	if err != nil {
+		return false, err
+	}
+	return repo != nil && repo.Status != repository.PENDING, nil
+}
+
+// headRef returns the reference HEAD points to in a repository
+func headRef(srv *context.T, reponame string) (string, error) {
+	repo, err := srv.DB.GetRepository(reponame)
+	if err != nil {
+		return "", err
+	}
+	if repo == nil {
+		return "refs/heads/" + repository.DEFAULT_BRANCH, nil
+	}
+	return repo.Head(), nil
+}
+
+// refAdvertisement lists the references of a repository the way they are
+// sent to protocol v0 clients, HEAD first
+func refAdvertisement(srv *context.T, reponame string) ([][]byte, error) {
+	refs, err := srv.DB.ListRefs(reponame)
+	if err != nil {
+		return nil, err
+	}
+	head, err := headRef(srv, reponame)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := srv.DB.GetRef(reponame, head)
+	if err != nil {
+		return nil, err
+	}
+	var reflines [][]byte
+	caps := capabilities()
+	if bytes.Compare(ref, repository.EmptyRef()) != 0 {
+		reflines = append(reflines, []byte(fmt.Sprintf("%s HEAD", ref)))
+		caps = append(caps, []byte(" symref=HEAD:"+head)...)
+	}
+	for i := range refs {
+		ref, err := srv.DB.GetRef(reponame, refs[i])
+		if err != nil {
+			return nil, err
+		}
+		reflines = append(reflines, []byte(fmt.Sprintf("%s %s", ref, refs[i])))
+	}
+
+	if len(reflines) == 0 {
+		reflines = append(reflines, []byte("0000000000000000000000000000000000000000 capabilities^{}"))
+	}
+	// capabilities follow the first reference
+	reflines[0] = append(append(reflines[0], 0), caps...)
+	for i := range reflines {
+		reflines[i] = append(reflines[i], 10) // LF
+	}
+	return reflines, nil
+}
+
+// advertiseRefs sends the references of a repository to a protocol v0
+// client over a stateful connection
+func advertiseRefs(srv *context.T, reponame string, w io.Writer) error {
+	reflines, err := refAdvertisement(srv, reponame)
+	if err != nil {
+		return err
+	}
+	enc := pktline.NewEncoder(w)
+	for i := range reflines {
+		enc.Encode(reflines[i])
+	}
+	return enc.Encode(nil)
 }
 
 func capabilities() []byte {
-	return []byte("report-status delete-refs side-band-64k quiet ofs-delta multi_ack_detailed agent=gitchain")
+	return []byte("report-status delete-refs atomic push-options side-band-64k quiet ofs-delta multi_ack_detailed shallow deepen-since deepen-not deepen-relative filter agent=gitchain")
 }
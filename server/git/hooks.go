@@ -0,0 +1,132 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sync"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spx/gitchain/repository"
+	"github.com/spx/gitchain/server/context"
+)
+
+// Hook lets policies be enforced on pushes and actions be triggered once
+// references are updated
+type Hook interface {
+	// PreReceive is called before the transaction updating the references
+	// of a push is created, an error rejecting all of them. Messages for
+	// the pusher can be written to out.
+	PreReceive(reponame string, updates []repository.RefUpdate, options []string, out io.Writer) error
+	// PostReceive is called once the references have been updated, by
+	// the node the push was received by only
+	PostReceive(reponame string, updates []repository.RefUpdate, options []string)
+}
+
+var hooks []Hook
+
+// pushes received by this node whose transactions haven't been applied
+// yet, with their push options
+var pushes = struct {
+	sync.Mutex
+	options map[string][]string
+}{options: make(map[string][]string)}
+
+// receivedPush records a push as received by this node
+func receivedPush(txhash []byte, options []string) {
+	pushes.Lock()
+	defer pushes.Unlock()
+	pushes.options[string(txhash)] = options
+}
+
+// RegisterHook adds a hook called for every repository
+func RegisterHook(hook Hook) {
+	hooks = append(hooks, hook)
+}
+
+func preReceive(reponame string, updates []repository.RefUpdate, options []string, out io.Writer) error {
+	for i := range hooks {
+		if err := hooks[i].PreReceive(reponame, updates, options, out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PostReceive calls the hooks once the transaction of a push has been
+// applied or rejected, if the push was received by this node and its
+// references were updated
+func PostReceive(txhash []byte, reponame string, updates []repository.RefUpdate, applied bool) {
+	pushes.Lock()
+	options, received := pushes.options[string(txhash)]
+	delete(pushes.options, string(txhash))
+	pushes.Unlock()
+	if !received || !applied {
+		return
+	}
+	for i := range hooks {
+		hooks[i].PostReceive(reponame, updates, options)
+	}
+}
+
+// ExecHook runs the pre-receive and post-receive executables found in
+// <data-path>/hooks the way git does: they read "<old> <new> <ref>" lines
+// and get push options in GIT_PUSH_OPTION_COUNT and GIT_PUSH_OPTION_<n>.
+// GITCHAIN_REPOSITORY is set to the name of the repository.
+type ExecHook struct {
+	dir string
+	log log15.Logger
+}
+
+func NewExecHook(srv *context.T) *ExecHook {
+	return &ExecHook{dir: path.Join(srv.Config.General.DataPath, "hooks"), log: srv.Log.New("cmp", "hooks")}
+}
+
+func (h *ExecHook) command(name, reponame string, updates []repository.RefUpdate, options []string) *exec.Cmd {
+	script := path.Join(h.dir, name)
+	if info, err := os.Stat(script); err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+		return nil
+	}
+	var stdin bytes.Buffer
+	for i := range updates {
+		fmt.Fprintf(&stdin, "%s %s %s\n", updates[i].Old, updates[i].New, updates[i].Ref)
+	}
+	cmd := exec.Command(script)
+	cmd.Dir = h.dir
+	cmd.Stdin = &stdin
+	cmd.Env = append(os.Environ(), "GITCHAIN_REPOSITORY="+reponame,
+		fmt.Sprintf("GIT_PUSH_OPTION_COUNT=%d", len(options)))
+	for i := range options {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("GIT_PUSH_OPTION_%d=%s", i, options[i]))
+	}
+	return cmd
+}
+
+func (h *ExecHook) PreReceive(reponame string, updates []repository.RefUpdate, options []string, out io.Writer) error {
+	cmd := h.command("pre-receive", reponame, updates, options)
+	if cmd == nil {
+		return nil
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Run(); err != nil {
+		h.log.Info("pre-receive hook declined", "repo", reponame, "err", err)
+		return errors.New("pre-receive hook declined")
+	}
+	return nil
+}
+
+func (h *ExecHook) PostReceive(reponame string, updates []repository.RefUpdate, options []string) {
+	cmd := h.command("post-receive", reponame, updates, options)
+	if cmd == nil {
+		return
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		h.log.Error("post-receive hook failed", "repo", reponame, "err", err, "output", string(output))
+	}
+}
@@ -0,0 +1,46 @@
+package git
+
+import (
+	"io"
+	"testing"
+
+	"github.com/spx/gitchain/repository"
+	"github.com/spx/gitchain/util"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingHook struct {
+	options [][]string
+}
+
+func (h *recordingHook) PreReceive(reponame string, updates []repository.RefUpdate, options []string, out io.Writer) error {
+	return nil
+}
+
+func (h *recordingHook) PostReceive(reponame string, updates []repository.RefUpdate, options []string) {
+	h.options = append(h.options, options)
+}
+
+func TestPostReceive(t *testing.T) {
+	hook := &recordingHook{}
+	defer func(registered []Hook) { hooks = registered }(hooks)
+	hooks = []Hook{hook}
+	updates := []repository.RefUpdate{{Ref: "refs/heads/master", Old: repository.EmptyRef(), New: util.SHA160([]byte("random"))}}
+
+	// pushed to another node
+	PostReceive(util.SHA256([]byte("tx1")), "repo", updates, true)
+	assert.Empty(t, hook.options)
+
+	receivedPush(util.SHA256([]byte("tx2")), []string{"option"})
+	PostReceive(util.SHA256([]byte("tx2")), "repo", updates, true)
+	assert.Equal(t, hook.options, [][]string{{"option"}})
+	// hooks only run once
+	PostReceive(util.SHA256([]byte("tx2")), "repo", updates, true)
+	assert.Equal(t, len(hook.options), 1)
+
+	// rejected
+	receivedPush(util.SHA256([]byte("tx3")), nil)
+	PostReceive(util.SHA256([]byte("tx3")), "repo", updates, false)
+	assert.Equal(t, len(hook.options), 1)
+	assert.Empty(t, pushes.options)
+}
@@ -0,0 +1,352 @@
+package git
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bargez/pktline"
+	"github.com/inconshreveable/log15"
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/server/context"
+)
+
+const (
+	pktFlush = iota
+	pktDelim
+	pktData
+)
+
+// pktReader reads pkt-lines, including the delimiter packets (0001)
+// protocol v2 uses to separate sections
+type pktReader struct {
+	reader io.Reader
+}
+
+func (r *pktReader) read() (kind int, line []byte, err error) {
+	header := make([]byte, 4)
+	if _, err = io.ReadFull(r.reader, header); err != nil {
+		return
+	}
+	sz, err := strconv.ParseUint(string(header), 16, 16)
+	if err != nil {
+		err = fmt.Errorf("malformed pkt-line length %q", header)
+		return
+	}
+	switch {
+	case sz == 0:
+		kind = pktFlush
+	case sz == 1:
+		kind = pktDelim
+	case sz < 4:
+		err = fmt.Errorf("unexpected pkt-line length %d", sz)
+	default:
+		kind = pktData
+		line = make([]byte, sz-4)
+		_, err = io.ReadFull(r.reader, line)
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+	}
+	return
+}
+
+// protocolVersion tells which version of the protocol the client asked for
+// in the Git-Protocol header
+func protocolVersion(req *http.Request) int {
+	for _, param := range strings.Split(req.Header.Get("Git-Protocol"), ":") {
+		if param == "version=2" {
+			return 2
+		}
+	}
+	return 0
+}
+
+func v2Capabilities() []string {
+	return []string{"agent=gitchain", "ls-refs", "fetch=shallow filter ref-in-want", "object-format=sha1"}
+}
+
+func advertiseV2(w io.Writer) {
+	enc := pktline.NewEncoder(w)
+	enc.Encode([]byte("version 2\n"))
+	for _, capability := range v2Capabilities() {
+		enc.Encode([]byte(capability + "\n"))
+	}
+	enc.Encode(nil)
+}
+
+// uploadPackV2 serves a protocol v2 command, returning false when the
+// client ended the session instead of sending one
+func uploadPackV2(srv *context.T, reponame string, r io.Reader, w io.Writer, log log15.Logger) bool {
+	reader := &pktReader{reader: r}
+	enc := pktline.NewEncoder(w)
+
+	var command string
+	var args [][]byte
+	inArgs, started := false, false
+	for {
+		kind, line, err := reader.read()
+		if err == io.EOF && !started {
+			return false
+		}
+		if err != nil {
+			log.Error("error while reading request", "err", err)
+			enc.Encode([]byte(fmt.Sprintf("ERR %v\n", err)))
+			return false
+		}
+		started = true
+		if kind == pktFlush {
+			break
+		}
+		switch {
+		case kind == pktDelim:
+			inArgs = true
+		case inArgs:
+			args = append(args, line)
+		case bytes.HasPrefix(line, []byte("command=")):
+			command = string(bytes.TrimPrefix(line, []byte("command=")))
+		}
+		// the client's capabilities (agent, object-format) don't
+		// change anything on our side
+	}
+
+	switch command {
+	case "":
+		// a lone flush ends the session
+		return false
+	case "ls-refs":
+		if err := lsRefs(srv, reponame, args, enc); err != nil {
+			log.Error("error while listing refs", "repo", reponame, "err", err)
+			enc.Encode([]byte(fmt.Sprintf("ERR %v\n", err)))
+			return false
+		}
+	case "fetch":
+		fetchV2(srv, reponame, args, w, log)
+	default:
+		enc.Encode([]byte(fmt.Sprintf("ERR unknown command %s\n", command)))
+		return false
+	}
+	return true
+}
+
+// peel follows annotated tags down to the object they point to
+func peel(srv *context.T, h git.Hash) (git.Hash, bool) {
+	peeled := false
+	for {
+		obj, err := readObject(srv, h)
+		if err != nil {
+			return h, peeled
+		}
+		tag, ok := obj.(*git.Tag)
+		if !ok {
+			return h, peeled
+		}
+		h = tag.Object
+		peeled = true
+	}
+}
+
+// resolveRef looks up a reference, HEAD being a symbolic reference
+// to the default branch
+func resolveRef(srv *context.T, reponame, name string) (git.Hash, error) {
+	if name == "HEAD" {
+		head, err := headRef(srv, reponame)
+		if err != nil {
+			return nil, err
+		}
+		name = head
+	}
+	ref, err := srv.DB.GetRef(reponame, name)
+	return git.Hash(ref), err
+}
+
+func lsRefs(srv *context.T, reponame string, args [][]byte, enc *pktline.Encoder) error {
+	var prefixes []string
+	symrefs, peeled := false, false
+	for i := range args {
+		switch {
+		case bytes.Compare(args[i], []byte("symrefs")) == 0:
+			symrefs = true
+		case bytes.Compare(args[i], []byte("peel")) == 0:
+			peeled = true
+		case bytes.HasPrefix(args[i], []byte("ref-prefix ")):
+			prefixes = append(prefixes, string(bytes.TrimPrefix(args[i], []byte("ref-prefix "))))
+		default:
+			return fmt.Errorf("unexpected argument %q", args[i])
+		}
+	}
+	matches := func(ref string) bool {
+		if len(prefixes) == 0 {
+			return true
+		}
+		for i := range prefixes {
+			if strings.HasPrefix(ref, prefixes[i]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	refs, err := srv.DB.ListRefs(reponame)
+	if err != nil {
+		return err
+	}
+	var lines [][]byte
+	empty := make([]byte, 20)
+	head, err := headRef(srv, reponame)
+	if err != nil {
+		return err
+	}
+	ref, err := srv.DB.GetRef(reponame, head)
+	if err != nil {
+		return err
+	}
+	if matches("HEAD") && bytes.Compare(ref, empty) != 0 {
+		line := fmt.Sprintf("%s HEAD", ref)
+		if symrefs {
+			line += " symref-target:" + head
+		}
+		lines = append(lines, []byte(line+"\n"))
+	}
+	for i := range refs {
+		if !matches(refs[i]) {
+			continue
+		}
+		ref, err := srv.DB.GetRef(reponame, refs[i])
+		if err != nil {
+			return err
+		}
+		if bytes.Compare(ref, empty) == 0 {
+			continue
+		}
+		line := fmt.Sprintf("%x %s", []byte(ref), refs[i])
+		if peeled {
+			if target, ok := peel(srv, git.Hash(ref)); ok {
+				line += fmt.Sprintf(" peeled:%s", target)
+			}
+		}
+		lines = append(lines, []byte(line+"\n"))
+	}
+	for i := range lines {
+		enc.Encode(lines[i])
+	}
+	return enc.Encode(nil)
+}
+
+func fetchV2(srv *context.T, reponame string, args [][]byte, w io.Writer, log log15.Logger) {
+	enc := pktline.NewEncoder(w)
+	n := newNegotiation(srv, reponame)
+	var acks []git.Hash
+	var wantedRefs []string
+	done := false
+
+	for i := range args {
+		if ok, err := n.request(args[i]); ok {
+			if err != nil {
+				enc.Encode([]byte(fmt.Sprintf("ERR %v\n", err)))
+				return
+			}
+			continue
+		}
+		split := bytes.SplitN(args[i], []byte{' '}, 2)
+		switch string(split[0]) {
+		case "done":
+			done = true
+		case "thin-pack", "no-progress", "include-tag", "ofs-delta":
+			// we never send deltas, progress or unrequested tags
+		case "want-ref":
+			if len(split) < 2 {
+				enc.Encode([]byte("ERR want-ref without a reference\n"))
+				return
+			}
+			ref, err := resolveRef(srv, reponame, string(split[1]))
+			if err != nil || bytes.Compare(ref, make([]byte, 20)) == 0 {
+				enc.Encode([]byte(fmt.Sprintf("ERR unknown ref %s\n", split[1])))
+				return
+			}
+			wantedRefs = append(wantedRefs, fmt.Sprintf("%s %s\n", ref, split[1]))
+			n.want(ref, nil)
+		case "want", "have":
+			if len(split) < 2 {
+				enc.Encode([]byte(fmt.Sprintf("ERR unexpected line %q\n", args[i])))
+				return
+			}
+			hash, err := hex.DecodeString(string(split[1]))
+			if err != nil || len(hash) != 20 {
+				enc.Encode([]byte(fmt.Sprintf("ERR error parsing hash %s\n", split[1])))
+				return
+			}
+			if string(split[0]) == "want" {
+				if ok, err := reachable(srv, reponame, hash); !ok {
+					log.Info("refused unreachable want", "repo", reponame, "want", git.Hash(hash), "err", err)
+					enc.Encode([]byte(fmt.Sprintf("ERR upload-pack: not our ref %s\n", split[1])))
+					return
+				}
+				n.want(hash, nil)
+			} else if n.have(hash) {
+				acks = append(acks, hash)
+			}
+		default:
+			enc.Encode([]byte(fmt.Sprintf("ERR unexpected argument %q\n", args[i])))
+			return
+		}
+	}
+
+	if !done {
+		enc.Encode([]byte("acknowledgments\n"))
+		if len(acks) == 0 {
+			enc.Encode([]byte("NAK\n"))
+		}
+		for i := range acks {
+			enc.Encode([]byte(fmt.Sprintf("ACK %s\n", acks[i])))
+		}
+		if !n.okToGiveUp() {
+			enc.Encode(nil) // the client will come back with more haves
+			return
+		}
+		enc.Encode([]byte("ready\n"))
+		w.Write([]byte("0001"))
+	}
+
+	if n.deepening() || len(n.clientShallow) > 0 {
+		shallow, err := n.shallow()
+		if err != nil {
+			enc.Encode([]byte(fmt.Sprintf("ERR %v\n", err)))
+			return
+		}
+		enc.Encode([]byte("shallow-info\n"))
+		for i := range shallow {
+			enc.Encode([]byte(fmt.Sprintf("shallow %s\n", shallow[i])))
+		}
+		for i := range n.unshallow {
+			enc.Encode([]byte(fmt.Sprintf("unshallow %s\n", n.unshallow[i])))
+		}
+		w.Write([]byte("0001"))
+	}
+
+	if len(wantedRefs) > 0 {
+		enc.Encode([]byte("wanted-refs\n"))
+		for i := range wantedRefs {
+			enc.Encode([]byte(wantedRefs[i]))
+		}
+		w.Write([]byte("0001"))
+	}
+
+	objects, err := n.objects()
+	if err != nil {
+		log.Error("error while collecting objects", "err", err)
+		enc.Encode([]byte(fmt.Sprintf("ERR %v\n", err)))
+		return
+	}
+	enc.Encode([]byte("packfile\n"))
+	pw := &sidebandWriter{writer: &pktlineWriter{encoder: enc}, band: 1, max: 65515}
+	err = git.WritePackfile(pw, git.NewPackfile(objects))
+	if err != nil {
+		log.Error("error while sending packfile", "err", err)
+		enc.Encode(append([]byte{3}, []byte(fmt.Sprintf("%s", err))...))
+		return
+	}
+	enc.Encode(nil)
+}
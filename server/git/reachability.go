@@ -0,0 +1,170 @@
+package git
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/repository"
+	"github.com/spx/gitchain/server/context"
+)
+
+// All repositories share the same object store, so objects are only served
+// to clients of a repository they are reachable from its current
+// references. An object is only recorded as reachable once all the objects
+// it refers to are, so references whose tips are recorded never have to be
+// walked again, and an object missing from the index while all tips are
+// recorded isn't reachable.
+
+// REINDEX_INTERVAL is how long a reference tip whose objects couldn't all
+// be retrieved is left alone before being walked again
+const REINDEX_INTERVAL = time.Minute
+
+var reachability = struct {
+	sync.Mutex
+	// indexing of a repository's references
+	repos map[string]*sync.Mutex
+	// last failure to index a reference tip
+	failures map[string]time.Time
+}{repos: make(map[string]*sync.Mutex), failures: make(map[string]time.Time)}
+
+// lockReachability keeps the reachability index of a repository from
+// being changed by anyone else until unlocked
+func lockReachability(reponame string) *sync.Mutex {
+	reachability.Lock()
+	lock, ok := reachability.repos[reponame]
+	if !ok {
+		lock = &sync.Mutex{}
+		reachability.repos[reponame] = lock
+	}
+	reachability.Unlock()
+	lock.Lock()
+	return lock
+}
+
+// indexTip records the objects reachable from tip as reachable from a
+// repository's references, not walking past the objects recorded
+// already. seen is called for every object walked.
+func indexTip(srv *context.T, reponame string, tip git.Hash, seen func(git.Hash)) error {
+	var found [][]byte
+	walker := git.NewWalker(func(h git.Hash) (git.Object, error) {
+		if seen != nil {
+			seen(h)
+		}
+		known, err := srv.DB.IsReachableObject(reponame, h)
+		if err != nil || known {
+			return nil, err
+		}
+		return readObject(srv, h)
+	})
+	err := walker.Walk([]git.Hash{tip}, func(obj git.Object) error {
+		found = append(found, obj.Hash())
+		return nil
+	})
+	key := reponame + "\x00" + string(tip)
+	reachability.Lock()
+	if err != nil {
+		reachability.failures[key] = time.Now()
+	} else {
+		delete(reachability.failures, key)
+	}
+	reachability.Unlock()
+	if err != nil {
+		// recording some of the objects would record objects whose
+		// own objects aren't
+		return err
+	}
+	return srv.DB.AddReachableObjects(reponame, found)
+}
+
+// indexRefs records the objects reachable from the references of a
+// repository whose tips aren't recorded yet, leaving alone those that
+// failed to be indexed recently
+func indexRefs(srv *context.T, reponame string) error {
+	refs, err := srv.DB.ListRefs(reponame)
+	if err != nil {
+		return err
+	}
+	// each reference is indexed on its own not to be held back by
+	// another one whose objects are missing
+	var indexErr error
+	for i := range refs {
+		ref, err := srv.DB.GetRef(reponame, refs[i])
+		if err != nil {
+			return err
+		}
+		if ref.Equals(repository.EmptyRef()) {
+			continue
+		}
+		known, err := srv.DB.IsReachableObject(reponame, ref)
+		if err != nil {
+			return err
+		}
+		reachability.Lock()
+		failed, ok := reachability.failures[reponame+"\x00"+string(ref)]
+		reachability.Unlock()
+		if known || (ok && time.Since(failed) < REINDEX_INTERVAL) {
+			continue
+		}
+		if err := indexTip(srv, reponame, git.Hash(ref), nil); err != nil && indexErr == nil {
+			indexErr = err
+		}
+	}
+	return indexErr
+}
+
+// UpdateReachable updates the objects recorded as reachable from the
+// references of a repository once updates have been applied to them. The
+// objects reachable from the new tips are recorded and, if a reference
+// was deleted or moved to a commit its previous tip isn't an ancestor of,
+// the index is started over.
+func UpdateReachable(srv *context.T, reponame string, updates []repository.RefUpdate) error {
+	defer lockReachability(reponame).Unlock()
+	var indexErr error
+	rebuild := false
+	for _, u := range updates {
+		if u.New.Equals(repository.EmptyRef()) {
+			rebuild = true
+			continue
+		}
+		extended := u.Old.Equals(repository.EmptyRef()) || u.Old.Equals(u.New)
+		err := indexTip(srv, reponame, git.Hash(u.New), func(h git.Hash) {
+			if bytes.Compare(h, u.Old) == 0 {
+				extended = true
+			}
+		})
+		if err != nil && indexErr == nil {
+			indexErr = err
+		}
+		// the old tip may have been reached through an object recorded
+		// already, which can't be told apart from it being dropped
+		rebuild = rebuild || !extended
+	}
+	if !rebuild {
+		return indexErr
+	}
+	if err := srv.DB.RemoveReachableObjects(reponame); err != nil {
+		return err
+	}
+	return indexRefs(srv, reponame)
+}
+
+// reachable tells whether an object can be reached from the references of
+// a repository
+func reachable(srv *context.T, reponame string, h git.Hash) (bool, error) {
+	known, err := srv.DB.IsReachableObject(reponame, h)
+	if err != nil || known {
+		return known, err
+	}
+	// references may have been updated before their objects were
+	// retrievable, or before objects were indexed at all
+	lock := lockReachability(reponame)
+	indexErr := indexRefs(srv, reponame)
+	lock.Unlock()
+	known, err = srv.DB.IsReachableObject(reponame, h)
+	if err != nil || known {
+		return known, err
+	}
+	return false, indexErr
+}
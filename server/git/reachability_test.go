@@ -0,0 +1,125 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/repository"
+	"github.com/spx/gitchain/server/config"
+	"github.com/spx/gitchain/server/context"
+	"github.com/spx/gitchain/server/objects"
+	"github.com/spx/gitchain/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixtureContext returns a context whose object requests are counted and
+// answered with no object
+func fixtureContext(t *testing.T) (srv *context.T, requests *int32) {
+	dir, err := ioutil.TempDir("", "gitchain")
+	if err != nil {
+		t.Fatalf("error creating data directory: %v", err)
+	}
+	srv = &context.T{Config: config.Default()}
+	srv.Config.General.DataPath = dir
+	if err = srv.Init(); err != nil {
+		t.Fatalf("error initializing context: %v", err)
+	}
+	srv.Log.SetHandler(log15.DiscardHandler())
+	requests = new(int32)
+	ch := srv.Router.Sub("/git/object/request")
+	go func() {
+		for msg := range ch {
+			atomic.AddInt32(requests, 1)
+			msg.(*objects.Request).ResponseChannel <- nil
+		}
+	}()
+	return
+}
+
+// fixtureCommit stores a commit of a single file
+func fixtureCommit(t *testing.T, srv *context.T, content string, parents ...git.Hash) (commit git.Hash, blob git.Hash) {
+	b := &git.Blob{Content: []byte(content)}
+	tree := &git.Tree{}
+	tree.SetBytes(append([]byte("100644 file\x00"), b.Hash()...))
+	text := fmt.Sprintf("tree %x\n", tree.Hash())
+	for _, p := range parents {
+		text += fmt.Sprintf("parent %s\n", p)
+	}
+	text += "author A <a@example.com> 1400000000 +0000\ncommitter A <a@example.com> 1400000000 +0000\n\n" + content + "\n"
+	c := &git.Commit{}
+	c.SetBytes([]byte(text))
+	for _, obj := range []git.Object{b, tree, c} {
+		if err := git.WriteObject(obj, objects.Dir(srv)); err != nil {
+			t.Fatalf("error writing object: %v", err)
+		}
+	}
+	return c.Hash(), b.Hash()
+}
+
+func updateRef(t *testing.T, srv *context.T, old, new git.Hash) error {
+	updates := []repository.RefUpdate{{Ref: "refs/heads/master", Old: repository.Ref(old), New: repository.Ref(new)}}
+	if updated, err := srv.DB.UpdateRefs("repo", updates); !updated || err != nil {
+		t.Fatalf("error updating reference: %v", err)
+	}
+	return UpdateReachable(srv, "repo", updates)
+}
+
+func assertReachable(t *testing.T, srv *context.T, expected map[string]bool) {
+	for h, ok := range expected {
+		r, err := reachable(srv, "repo", git.Hash(h))
+		assert.Nil(t, err)
+		assert.Equal(t, r, ok, git.Hash(h).String())
+	}
+}
+
+func TestReachable(t *testing.T) {
+	srv, requests := fixtureContext(t)
+	defer os.RemoveAll(srv.Config.General.DataPath)
+	empty := git.Hash(repository.EmptyRef())
+
+	c1, b1 := fixtureCommit(t, srv, "first")
+	c2, b2 := fixtureCommit(t, srv, "second", c1)
+	random := git.Hash(util.SHA160([]byte("random")))
+
+	assertReachable(t, srv, map[string]bool{string(c1): false, string(c2): false})
+
+	assert.Nil(t, updateRef(t, srv, empty, c1))
+	assertReachable(t, srv, map[string]bool{string(c1): true, string(b1): true, string(c2): false, string(b2): false})
+
+	// fast-forward
+	assert.Nil(t, updateRef(t, srv, c1, c2))
+	assertReachable(t, srv, map[string]bool{string(c1): true, string(b1): true, string(c2): true, string(b2): true})
+
+	// rewind
+	assert.Nil(t, updateRef(t, srv, c2, c1))
+	assertReachable(t, srv, map[string]bool{string(c1): true, string(b1): true, string(c2): false, string(b2): false, string(random): false})
+
+	// deletion
+	assert.Nil(t, updateRef(t, srv, c1, empty))
+	assertReachable(t, srv, map[string]bool{string(c1): false, string(b1): false})
+
+	// unknown objects are never looked for while all tips are indexed
+	assert.Equal(t, atomic.LoadInt32(requests), int32(0))
+
+	// a tip whose objects are missing is only walked again after a while
+	assert.NotNil(t, updateRef(t, srv, empty, random))
+	assert.Equal(t, atomic.LoadInt32(requests), int32(1))
+	assertReachable(t, srv, map[string]bool{string(c1): false, string(c2): false})
+	assert.Equal(t, atomic.LoadInt32(requests), int32(1))
+}
+
+func TestReachableIndexedLazily(t *testing.T) {
+	srv, _ := fixtureContext(t)
+	defer os.RemoveAll(srv.Config.General.DataPath)
+
+	c1, b1 := fixtureCommit(t, srv, "first")
+	// references updated before their objects were indexed
+	_, err := srv.DB.UpdateRefs("repo", []repository.RefUpdate{{Ref: "refs/heads/master", Old: repository.EmptyRef(), New: repository.Ref(c1)}})
+	assert.Nil(t, err)
+	assertReachable(t, srv, map[string]bool{string(b1): true, string(util.SHA160([]byte("random"))): false})
+}
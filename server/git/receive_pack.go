@@ -0,0 +1,299 @@
+package git
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"code.google.com/p/go.crypto/openpgp"
+	"github.com/bargez/pktline"
+	"github.com/inconshreveable/log15"
+	"github.com/spx/gitchain/block"
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/repository"
+	"github.com/spx/gitchain/server/context"
+	"github.com/spx/gitchain/server/objects"
+	"github.com/spx/gitchain/transaction"
+	"github.com/spx/gitchain/types"
+)
+
+// receivePack serves a receive-pack request, signing the reference update
+// transactions with the pusher's key
+func receivePack(srv *context.T, reponame string, r io.Reader, w io.Writer, key *ecdsa.PrivateKey, log log15.Logger) {
+	var lines [][]byte
+	dec := pktline.NewDecoder(r)
+	dec.DecodeUntilFlush(&lines)
+	enc := pktline.NewEncoder(w)
+
+	var commands []command
+	for i := range lines {
+		cmd, err := parseCommand(lines[i])
+		if err != nil {
+			enc.Encode(append([]byte{3}, []byte(fmt.Sprintf("%v\n", err))...))
+			return
+		}
+		commands = append(commands, cmd)
+	}
+	if len(commands) == 0 {
+		return // nothing to update
+	}
+
+	var wait time.Duration
+	var options []string
+	if hasCapability(lines[0], "push-options") {
+		var optionLines [][]byte
+		dec.DecodeUntilFlush(&optionLines)
+		for i := range optionLines {
+			option := string(bytes.TrimRight(optionLines[i], "\n"))
+			options = append(options, option)
+			if !strings.HasPrefix(option, "gitchain.wait=") {
+				continue
+			}
+			seconds, err := strconv.Atoi(strings.TrimPrefix(option, "gitchain.wait="))
+			if err != nil || seconds < 0 {
+				enc.Encode(append([]byte{3}, []byte(fmt.Sprintf("Invalid push option %s\n", option))...))
+				return
+			}
+			wait = time.Duration(seconds) * time.Second
+		}
+	}
+
+	// no packfile is sent when references are only deleted
+	deletesOnly := true
+	for i := range commands {
+		if bytes.Compare(commands[i].new, make([]byte, 20)) != 0 {
+			deletesOnly = false
+		}
+	}
+
+	objectsDir := objects.Dir(srv)
+	var packfile *git.Packfile
+	var err error
+	if deletesOnly {
+		packfile = &git.Packfile{}
+	} else {
+		packfile, err = git.ReadPackfile(r)
+	}
+	if err == nil {
+		err = packfile.ResolveDeltas(func(h git.Hash) (git.Object, error) {
+			return objects.Read(srv, h)
+		})
+	}
+	fsck := git.NewFsck(packfile, func(h git.Hash) bool {
+		if objects.Exists(srv, h) {
+			return true
+		}
+		// the object may have been pushed to another node
+		_, err := objects.Read(srv, h)
+		return err == nil
+	})
+	if err == nil {
+		err = fsck.CheckObjects()
+	}
+	if err != nil {
+		log.Error("rejected packfile", "repo", reponame, "err", err)
+		enc.Encode(append([]byte{1}, pktlineToBytes([]byte(fmt.Sprintf("unpack %v\n", err)))...))
+		for i := range commands {
+			enc.Encode(append([]byte{1}, pktlineToBytes([]byte(fmt.Sprintf("ng %s unpacker error\n", commands[i].ref)))...))
+		}
+	} else {
+		enc.Encode(append([]byte{1}, pktlineToBytes([]byte("unpack ok"))...))
+		// objects are only stored and announced once the reference updates
+		// they come with are accepted, until then they are read from the
+		// packfile
+		read := func(h git.Hash) (git.Object, error) {
+			if obj := packfile.ObjectByHash(h); obj != nil {
+				return obj, nil
+			}
+			return readObject(srv, h)
+		}
+		var keyring openpgp.EntityList
+		signed := requiresSignatures(srv, reponame)
+		if signed {
+			if keyring, err = signingKeys(srv, reponame); err != nil {
+				log.Error("error while retrieving signing keys", "repo", reponame, "err", err)
+			}
+		}
+		// commands are either all applied in a single transaction or, if
+		// any is rejected and the client asked for an atomic push, none
+		reasons := make([]string, len(commands))
+		var updates []repository.RefUpdate
+		for i := range commands {
+			reasons[i] = checkCommand(srv, reponame, commands[i], fsck, read, signed, keyring, log)
+			if reasons[i] == "" {
+				updates = append(updates, repository.RefUpdate{Ref: commands[i].ref,
+					Old: repository.Ref(commands[i].old), New: repository.Ref(commands[i].new)})
+			}
+		}
+		if len(updates) < len(commands) && hasCapability(lines[0], "atomic") {
+			for i := range reasons {
+				if reasons[i] == "" {
+					reasons[i] = "atomic push failed"
+				}
+			}
+			updates = nil
+		}
+		if len(updates) > 0 {
+			out := &sidebandWriter{writer: &pktlineWriter{encoder: enc}, band: 2, max: 65515}
+			if err := preReceive(reponame, updates, options, out); err != nil {
+				for i := range reasons {
+					if reasons[i] == "" {
+						reasons[i] = err.Error()
+					}
+				}
+				updates = nil
+			}
+		}
+		if len(updates) > 0 {
+			for i := range packfile.Objects {
+				if err = git.WriteObject(packfile.Objects[i], objectsDir); err != nil {
+					break
+				}
+			}
+			if err != nil {
+				log.Error("error while writing objects", "repo", reponame, "err", err)
+				for i := range reasons {
+					if reasons[i] == "" {
+						reasons[i] = "error while writing objects"
+					}
+				}
+				updates = nil
+			} else {
+				for i := range packfile.Objects {
+					srv.Router.Pub(packfile.Objects[i], "/git/object")
+				}
+			}
+		}
+		if len(updates) > 0 {
+			var tx transaction.T
+			if len(updates) == 1 {
+				tx = transaction.NewReferenceUpdate(reponame, updates[0].Ref, updates[0].Old, updates[0].New)
+			} else {
+				tx = transaction.NewBatchReferenceUpdate(reponame, updates)
+			}
+			hash, err := srv.DB.GetPreviousEnvelopeHashForPublicKey(&key.PublicKey)
+			if err != nil {
+				enc.Encode(append([]byte{3}, []byte(fmt.Sprintf("Error while preparing transaction: %v", err))...))
+				return
+			}
+
+			txe := transaction.NewEnvelope(hash, tx)
+			txe.Sign(key)
+
+			enc.Encode(append([]byte{2}, []byte(fmt.Sprintf("[gitchain] Transaction %s\n", txe.Hash()))...))
+			receivedPush(txe.Hash(), options)
+			var ch chan interface{}
+			if wait > 0 {
+				// subscribe first not to miss the outcome
+				ch = srv.Router.Sub("/block/last", "/git/ref-update")
+			}
+			srv.Router.Pub(txe, "/transaction")
+			if wait > 0 {
+				status := waitForRefUpdate(srv, txe.Hash(), ch, wait, w, log)
+				srv.Router.Unsub(ch)
+				if status != "" && status != repository.REF_UPDATE_APPLIED {
+					for i := range reasons {
+						if reasons[i] == "" {
+							reasons[i] = status
+						}
+					}
+				}
+			}
+		}
+		for i := range commands {
+			if reasons[i] == "" {
+				enc.Encode(append([]byte{1}, pktlineToBytes([]byte(fmt.Sprintf("ok %s\n", commands[i].ref)))...))
+			} else {
+				enc.Encode(append([]byte{1}, pktlineToBytes([]byte(fmt.Sprintf("ng %s %s\n", commands[i].ref, reasons[i])))...))
+			}
+		}
+	}
+	enc.Encode(append([]byte{1}, pktlineToBytes(nil)...))
+	enc.Encode(nil)
+}
+
+// checkCommand tells why a reference update can't be made, returning an
+// empty string if it can
+func checkCommand(srv *context.T, reponame string, cmd command, fsck *git.Fsck, read func(git.Hash) (git.Object, error), signed bool, keyring openpgp.EntityList, log log15.Logger) string {
+	current, err := srv.DB.GetRef(reponame, cmd.ref)
+	if err != nil {
+		log.Error("error while retrieving reference", "repo", reponame, "ref", cmd.ref, "err", err)
+		return err.Error()
+	}
+	if !current.Equals(repository.Ref(cmd.old)) {
+		return "stale info"
+	}
+	if bytes.Compare(cmd.new, make([]byte, 20)) != 0 {
+		if err := fsck.CheckConnectivity(cmd.new); err != nil {
+			log.Error("rejected reference update", "repo", reponame, "ref", cmd.ref, "err", err)
+			return "missing objects"
+		}
+		if signed {
+			if err := checkSignatures(srv, reponame, cmd, read, keyring); err != nil {
+				log.Error("rejected unsigned reference update", "repo", reponame, "ref", cmd.ref, "err", err)
+				return err.Error()
+			}
+		}
+	}
+	if err := CheckRefUpdate(srv, reponame, cmd.ref, cmd.old, cmd.new); err != nil {
+		log.Error("rejected reference update", "repo", reponame, "ref", cmd.ref, "err", err)
+		return err.Error()
+	}
+	if err := CheckFastForward(srv, reponame, cmd.ref, cmd.old, cmd.new, read); err != nil {
+		log.Error("rejected reference update", "repo", reponame, "ref", cmd.ref, "err", err)
+		return err.Error()
+	}
+	return ""
+}
+
+// waitForRefUpdate reports the confirmations of a reference update
+// transaction over sideband 2 until it is applied or rejected, or until
+// timeout, returning its status (empty if it's still pending)
+func waitForRefUpdate(srv *context.T, hash types.Hash, ch chan interface{}, timeout time.Duration, w io.Writer, log log15.Logger) string {
+	enc := pktline.NewEncoder(w)
+	progress := func(format string, args ...interface{}) {
+		enc.Encode(append([]byte{2}, []byte(fmt.Sprintf("[gitchain] "+format+"\n", args...))...))
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	progress("Waiting for transaction %s to be confirmed", hash)
+	deadline := time.After(timeout)
+	for {
+		select {
+		case msg := <-ch:
+			switch msg.(type) {
+			case *block.Block:
+				confirmations, err := srv.DB.GetTransactionConfirmations(hash)
+				if err != nil {
+					// not included in a block yet
+					continue
+				}
+				progress("Transaction %s has %d confirmation(s)", hash, confirmations)
+			case types.Hash:
+				if !hash.Equals(msg.(types.Hash)) {
+					continue
+				}
+				status, err := srv.DB.GetRefUpdateStatus(hash)
+				if err != nil {
+					log.Error("error while retrieving reference update status", "txn", hash, "err", err)
+					return ""
+				}
+				if status == repository.REF_UPDATE_APPLIED {
+					progress("Transaction %s has been applied", hash)
+				} else {
+					progress("Transaction %s has been rejected: %s", hash, status)
+				}
+				return status
+			}
+		case <-deadline:
+			progress("Transaction %s is still pending, check it with gitchain push-status %s", hash, hash)
+			return ""
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/server/context"
+)
+
+var (
+	ErrProtectedBranch = errors.New("protected branch")
+	ErrNonFastForward  = errors.New("non-fast-forward")
+)
+
+// CheckRefUpdate tells whether a reference can be moved from old to new,
+// protected branches not being deleted. It only depends on the state of
+// the chain so that every node reaches the same decision when applying a
+// confirmed transaction. It doesn't check whether the reference currently
+// points to old.
+func CheckRefUpdate(srv *context.T, reponame, ref string, old, new git.Hash) error {
+	repo, err := srv.DB.GetRepository(reponame)
+	if err != nil {
+		return err
+	}
+	if repo == nil {
+		return fmt.Errorf("unknown repository %s", reponame)
+	}
+	if repo.Protected(ref) && bytes.Compare(new, make([]byte, 20)) == 0 {
+		return ErrProtectedBranch
+	}
+	return nil
+}
+
+// CheckFastForward tells whether moving a reference from old to new
+// doesn't rewind a protected branch, retrieving commits with read. As it
+// depends on the objects at hand, it is checked when a push is received
+// rather than when its transaction is applied, protection against rewinds
+// being only as good as the node receiving the push.
+func CheckFastForward(srv *context.T, reponame, ref string, old, new git.Hash, read func(git.Hash) (git.Object, error)) error {
+	repo, err := srv.DB.GetRepository(reponame)
+	if err != nil {
+		return err
+	}
+	if repo == nil {
+		return fmt.Errorf("unknown repository %s", reponame)
+	}
+	empty := make([]byte, 20)
+	if !repo.Protected(ref) || bytes.Compare(old, empty) == 0 || bytes.Compare(new, empty) == 0 {
+		return nil
+	}
+	ok, err := git.IsAncestor(read, old, new)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNonFastForward
+	}
+	return nil
+}
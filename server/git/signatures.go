@@ -0,0 +1,113 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"code.google.com/p/go.crypto/openpgp"
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/server/context"
+)
+
+// requiresSignatures tells whether every commit and annotated tag pushed
+// to a repository must be signed by one of its authorized pushers
+func requiresSignatures(srv *context.T, reponame string) bool {
+	for _, name := range srv.Config.Git.SignedRepositories {
+		if name == reponame {
+			return true
+		}
+	}
+	return false
+}
+
+// signingKeys returns the commit signing keys published on chain by the
+// authorized pushers of a repository, that is by the key holder who
+// allocated its name
+func signingKeys(srv *context.T, reponame string) (keyring openpgp.EntityList, err error) {
+	owner, err := srv.DB.GetRepositoryOwner(reponame)
+	if err != nil {
+		return nil, err
+	}
+	if owner == nil {
+		return nil, fmt.Errorf("unknown repository %s", reponame)
+	}
+	keys, err := srv.DB.ListSigningKeys(owner)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(keys[i]))
+		if err != nil {
+			srv.Log.Error("invalid signing key", "cmp", "git", "repo", reponame, "err", err)
+			continue
+		}
+		keyring = append(keyring, entities...)
+	}
+	return
+}
+
+func verifySignature(keyring openpgp.EntityList, payload []byte, signature string) error {
+	if signature == "" {
+		return errors.New("not signed")
+	}
+	if _, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(payload), strings.NewReader(signature)); err != nil {
+		return fmt.Errorf("bad signature (%v)", err)
+	}
+	return nil
+}
+
+// checkSignatures verifies the signatures of the commits and annotated
+// tags a reference update brings into a repository, retrieving them with
+// read
+func checkSignatures(srv *context.T, reponame string, cmd command, read func(git.Hash) (git.Object, error), keyring openpgp.EntityList) error {
+	// objects reachable from the repository's references were checked
+	// when they were pushed, and are recorded as such unless their
+	// references couldn't be indexed
+	lock := lockReachability(reponame)
+	indexRefs(srv, reponame)
+	lock.Unlock()
+	walker := git.NewWalker(func(h git.Hash) (git.Object, error) {
+		known, err := srv.DB.IsReachableObject(reponame, h)
+		if err != nil || known {
+			return nil, err
+		}
+		return read(h)
+	})
+	walker.Filter = func(git.Object, int) bool { return false }
+	refs, err := srv.DB.ListRefs(reponame)
+	if err != nil {
+		return err
+	}
+	var existing []git.Hash
+	for i := range refs {
+		ref, err := srv.DB.GetRef(reponame, refs[i])
+		if err != nil {
+			return err
+		}
+		existing = append(existing, git.Hash(ref))
+	}
+	var tips []git.Hash
+	for _, h := range append(existing, cmd.old) {
+		if bytes.Compare(h, make([]byte, 20)) != 0 {
+			tips = append(tips, h)
+		}
+	}
+	if err = walker.Walk(tips, nil); err != nil {
+		return err
+	}
+	return walker.Walk([]git.Hash{cmd.new}, func(obj git.Object) error {
+		switch o := obj.(type) {
+		case *git.Commit:
+			if err := verifySignature(keyring, o.SignedPayload(), o.Signature); err != nil {
+				return fmt.Errorf("commit %x %v", o.Hash(), err)
+			}
+		case *git.Tag:
+			if err := verifySignature(keyring, o.SignedPayload(), o.Signature); err != nil {
+				return fmt.Errorf("tag %s %v", o.Tag, err)
+			}
+		}
+		return nil
+	})
+}
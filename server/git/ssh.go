@@ -0,0 +1,195 @@
+package git
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"code.google.com/p/go.crypto/ssh"
+	"github.com/inconshreveable/log15"
+	"github.com/spx/gitchain/server/context"
+)
+
+// hostKey loads the SSH host key of the node, generating it on first use
+func hostKey(srv *context.T) (ssh.Signer, error) {
+	file := filepath.Join(srv.Config.General.DataPath, "ssh_host_key")
+	encoded, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		encoded = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		if err = ioutil.WriteFile(file, encoded, 0600); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKey(encoded)
+}
+
+// SSH serves repositories over SSH. Users authenticate with an SSH key
+// authorized for one of the node's keypairs, which then signs the
+// reference updates they push.
+func SSH(srv *context.T) {
+	log := srv.Log.New("cmp", "git-ssh")
+	if srv.Config.Git.SSHPort == 0 {
+		return
+	}
+	signer, err := hostKey(srv)
+	if err != nil {
+		log.Error("can't load host key", "err", err)
+		return
+	}
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			alias, err := srv.DB.GetSSHKeyAlias(key.Marshal())
+			if err != nil {
+				return nil, err
+			}
+			if alias == "" {
+				return nil, fmt.Errorf("%s key of %s isn't authorized", key.Type(), conn.RemoteAddr())
+			}
+			return &ssh.Permissions{Extensions: map[string]string{"alias": alias}}, nil
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", srv.Config.Git.SSHPort))
+	if err != nil {
+		log.Error("can't listen", "port", srv.Config.Git.SSHPort, "err", err)
+		return
+	}
+	log.Info("listening", "port", srv.Config.Git.SSHPort)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			log.Error("error while accepting connection", "err", err)
+			continue
+		}
+		go serveSSHConnection(srv, conn, config, log)
+	}
+}
+
+func serveSSHConnection(srv *context.T, conn net.Conn, config *ssh.ServerConfig, log log15.Logger) {
+	sconn, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		log.Debug("handshake failed", "addr", conn.RemoteAddr(), "err", err)
+		return
+	}
+	defer sconn.Close()
+	alias := sconn.Permissions.Extensions["alias"]
+	log = log.New("alias", alias, "addr", conn.RemoteAddr())
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			log.Error("error while accepting channel", "err", err)
+			continue
+		}
+		go serveSSHSession(srv, channel, requests, alias, log)
+	}
+}
+
+// serveSSHSession runs the git command requested in a session (other
+// requests, such as for a shell, are declined)
+func serveSSHSession(srv *context.T, channel ssh.Channel, requests <-chan *ssh.Request, alias string, log log15.Logger) {
+	defer channel.Close()
+	version := 0
+	for req := range requests {
+		switch req.Type {
+		case "env":
+			var env struct{ Name, Value string }
+			if ssh.Unmarshal(req.Payload, &env) == nil && env.Name == "GIT_PROTOCOL" {
+				for _, param := range strings.Split(env.Value, ":") {
+					if param == "version=2" {
+						version = 2
+					}
+				}
+			}
+			req.Reply(true, nil)
+		case "exec":
+			var exec struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &exec); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			status := runSSHCommand(srv, channel, exec.Command, version, alias, log)
+			channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+			return
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// runSSHCommand runs "git-upload-pack '<repository>'" or
+// "git-receive-pack '<repository>'", returning its exit status
+func runSSHCommand(srv *context.T, channel ssh.Channel, command string, version int, alias string, log log15.Logger) uint32 {
+	split := strings.SplitN(command, " ", 2)
+	if len(split) != 2 || (split[0] != "git-upload-pack" && split[0] != "git-receive-pack") {
+		fmt.Fprintf(channel.Stderr(), "gitchain: unsupported command %q\n", command)
+		return 1
+	}
+	reponame := strings.TrimPrefix(strings.Trim(split[1], "'\""), "/")
+	log = log.New("cmp", split[0], "repo", reponame)
+	active, err := activeRepository(srv, reponame)
+	if err != nil {
+		log.Error("error while retrieving repository", "err", err)
+		fmt.Fprintf(channel.Stderr(), "gitchain: internal error\n")
+		return 1
+	}
+	if !active {
+		fmt.Fprintf(channel.Stderr(), "gitchain: repository %s not found\n", reponame)
+		return 1
+	}
+
+	var key *ecdsa.PrivateKey
+	if split[0] == "git-receive-pack" {
+		if key, err = srv.DB.GetKey(alias); err != nil {
+			log.Error("error while retrieving private key", "err", err)
+			fmt.Fprintf(channel.Stderr(), "gitchain: internal error\n")
+			return 1
+		}
+		if key == nil {
+			fmt.Fprintf(channel.Stderr(), "gitchain: no private key %s to sign the transaction\n", alias)
+			return 1
+		}
+	}
+
+	if split[0] == "git-upload-pack" && version == 2 {
+		advertiseV2(channel)
+		for uploadPackV2(srv, reponame, channel, channel, log) {
+		}
+		return 0
+	}
+	if err := advertiseRefs(srv, reponame, channel); err != nil {
+		log.Error("error listing refs", "err", err)
+		fmt.Fprintf(channel.Stderr(), "gitchain: internal error\n")
+		return 1
+	}
+	if split[0] == "git-upload-pack" {
+		uploadPack(srv, reponame, channel, channel, false, log)
+	} else {
+		receivePack(srv, reponame, channel, channel, key, log)
+	}
+	return 0
+}
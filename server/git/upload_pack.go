@@ -0,0 +1,516 @@
+package git
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/bargez/pktline"
+	"github.com/inconshreveable/log15"
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/server/context"
+	"github.com/spx/gitchain/server/objects"
+)
+
+const (
+	multiAckNone = iota
+	multiAck
+	multiAckDetailed
+)
+
+func readObject(srv *context.T, h git.Hash) (git.Object, error) {
+	obj, err := objects.Read(srv, h)
+	if err != nil {
+		return nil, fmt.Errorf("object %s is unretrievable: %v", h, err)
+	}
+	return obj, nil
+}
+
+// negotiation keeps track of the have/want exchange of upload-pack
+type negotiation struct {
+	srv      *context.T
+	reponame string
+	wants    []git.Hash
+	caps     map[string]bool
+	multiAck int
+	// commits the client has told us about (and their parents)
+	theyHave map[string]bool
+	// wants that are known to reach something the client has
+	satisfied map[string]bool
+	common    []git.Hash
+	// commits whose parents the client doesn't have
+	clientShallow  map[string]bool
+	depth          int
+	deepenSince    int64
+	deepenNot      []string
+	deepenRelative bool
+	filter         *objectFilter
+	// commits whose parents won't be sent, and client's shallow
+	// commits that will be complete once the packfile is received
+	boundary  map[string]bool
+	unshallow []git.Hash
+}
+
+func newNegotiation(srv *context.T, reponame string) *negotiation {
+	return &negotiation{
+		srv:           srv,
+		reponame:      reponame,
+		caps:          make(map[string]bool),
+		theyHave:      make(map[string]bool),
+		satisfied:     make(map[string]bool),
+		clientShallow: make(map[string]bool)}
+}
+
+func (n *negotiation) want(h git.Hash, caps [][]byte) {
+	n.wants = append(n.wants, h)
+	for i := range caps {
+		n.caps[string(caps[i])] = true
+	}
+	switch {
+	case n.caps["multi_ack_detailed"]:
+		n.multiAck = multiAckDetailed
+	case n.caps["multi_ack"]:
+		n.multiAck = multiAck
+	}
+	// v2 sends it as an argument instead
+	n.deepenRelative = n.deepenRelative || n.caps["deepen-relative"]
+}
+
+// request handles the shallow, deepen and filter lines shared by all
+// versions of the protocol, reporting whether line was one of them
+func (n *negotiation) request(line []byte) (ok bool, err error) {
+	if bytes.Compare(line, []byte("deepen-relative")) == 0 {
+		n.deepenRelative = true
+		return true, nil
+	}
+	split := bytes.SplitN(line, []byte{' '}, 2)
+	if len(split) < 2 {
+		return false, nil
+	}
+	arg := string(split[1])
+	switch string(split[0]) {
+	case "shallow":
+		h, err := hex.DecodeString(arg)
+		if err != nil || len(h) != 20 {
+			return true, fmt.Errorf("error parsing hash %s", arg)
+		}
+		n.clientShallow[string(h)] = true
+	case "deepen":
+		n.depth, err = strconv.Atoi(arg)
+		if err != nil || n.depth <= 0 {
+			return true, fmt.Errorf("invalid depth %s", arg)
+		}
+	case "deepen-since":
+		n.deepenSince, err = strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return true, fmt.Errorf("invalid timestamp %s", arg)
+		}
+	case "deepen-not":
+		n.deepenNot = append(n.deepenNot, arg)
+	case "filter":
+		n.filter, err = parseFilter(arg)
+	default:
+		return false, nil
+	}
+	return true, err
+}
+
+func (n *negotiation) deepening() bool {
+	return n.depth > 0 || n.deepenSince > 0 || len(n.deepenNot) > 0
+}
+
+// have records an object the client has and reports whether we have it
+// as well
+func (n *negotiation) have(h git.Hash) bool {
+	// objects of other repositories are as good as missing
+	if known, err := n.srv.DB.IsReachableObject(n.reponame, h); err != nil || !known {
+		return false
+	}
+	// there is no point in asking the network about objects the
+	// client has, we will be sending objects only we have
+	obj, err := objects.ReadLocal(n.srv, h)
+	if err != nil {
+		return false
+	}
+	if commit, ok := obj.(*git.Commit); ok {
+		if n.theyHave[string(h)] {
+			return true
+		}
+		n.theyHave[string(h)] = true
+		if !n.clientShallow[string(h)] {
+			for i := range commit.Parents {
+				n.theyHave[string(commit.Parents[i])] = true
+			}
+		}
+	}
+	n.common = append(n.common, h)
+	return true
+}
+
+// okToGiveUp tells whether every want reaches a commit the client has,
+// in which case there is no point in continuing the negotiation
+func (n *negotiation) okToGiveUp() bool {
+	if len(n.common) == 0 {
+		return false
+	}
+	for i := range n.wants {
+		if !n.satisfied[string(n.wants[i])] && !n.reachesCommon(n.wants[i]) {
+			return false
+		}
+		n.satisfied[string(n.wants[i])] = true
+	}
+	return true
+}
+
+func (n *negotiation) reachesCommon(want git.Hash) bool {
+	visited := make(map[string]bool)
+	queue := []git.Hash{want}
+	for len(queue) > 0 {
+		h := queue[0]
+		queue = queue[1:]
+		if visited[string(h)] {
+			continue
+		}
+		visited[string(h)] = true
+		if n.theyHave[string(h)] {
+			return true
+		}
+		obj, err := readObject(n.srv, h)
+		if err != nil {
+			continue
+		}
+		if commit, ok := obj.(*git.Commit); ok {
+			queue = append(queue, commit.Parents...)
+		}
+	}
+	return false
+}
+
+func (n *negotiation) walker() *git.Walker {
+	return git.NewWalker(func(h git.Hash) (git.Object, error) {
+		return readObject(n.srv, h)
+	})
+}
+
+// reachable returns every commit reachable from the given references
+func (n *negotiation) reachable(refs []string) (map[string]bool, error) {
+	commits := make(map[string]bool)
+	var tips []git.Hash
+	for i := range refs {
+		var ref git.Hash
+		// the references may be abbreviated (v1.0 for refs/tags/v1.0)
+		for _, name := range []string{refs[i], "refs/" + refs[i], "refs/tags/" + refs[i], "refs/heads/" + refs[i]} {
+			h, err := resolveRef(n.srv, n.reponame, name)
+			if err != nil {
+				return nil, err
+			}
+			if bytes.Compare(h, make([]byte, 20)) != 0 {
+				ref = h
+				break
+			}
+		}
+		if ref == nil {
+			return nil, fmt.Errorf("unknown ref %s", refs[i])
+		}
+		tips = append(tips, ref)
+	}
+	walker := n.walker()
+	walker.Filter = func(git.Object, int) bool { return false }
+	err := walker.Walk(tips, func(obj git.Object) error {
+		if _, ok := obj.(*git.Commit); ok {
+			commits[string(obj.Hash())] = true
+		}
+		return nil
+	})
+	return commits, err
+}
+
+// shallow works out where the history sent to the client will be cut
+// off, returning the client's new shallow commits
+func (n *negotiation) shallow() (shallow []git.Hash, err error) {
+	n.boundary = make(map[string]bool)
+	n.unshallow = nil
+	if !n.deepening() {
+		// the client doesn't want its shallow commits completed
+		for h := range n.clientShallow {
+			n.boundary[h] = true
+		}
+		return
+	}
+	excluded, err := n.reachable(n.deepenNot)
+	if err != nil {
+		return
+	}
+	cut := func(commit *git.Commit) (bool, error) {
+		for i := range commit.Parents {
+			if excluded[string(commit.Parents[i])] {
+				return true, nil
+			}
+			if n.deepenSince > 0 {
+				obj, err := readObject(n.srv, commit.Parents[i])
+				if err != nil {
+					return false, err
+				}
+				if parent, ok := obj.(*git.Commit); ok && parent.Time() < n.deepenSince {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+
+	type item struct {
+		hash git.Hash
+		// with deepen-relative, depth stays at 0 until we
+		// reach the client's shallow commits
+		depth int
+	}
+	var queue []item
+	for i := range n.wants {
+		if n.deepenRelative {
+			queue = append(queue, item{n.wants[i], 0})
+		} else {
+			queue = append(queue, item{n.wants[i], 1})
+		}
+	}
+	visited := make(map[string]bool)
+	for len(queue) > 0 {
+		it := queue[0]
+		queue = queue[1:]
+		if visited[string(it.hash)] {
+			continue
+		}
+		visited[string(it.hash)] = true
+		var obj git.Object
+		obj, err = readObject(n.srv, it.hash)
+		if err != nil {
+			return
+		}
+		if tag, ok := obj.(*git.Tag); ok {
+			queue = append(queue, item{tag.Object, it.depth})
+			continue
+		}
+		commit, ok := obj.(*git.Commit)
+		if !ok {
+			continue
+		}
+		stop := n.depth > 0 && it.depth >= n.depth
+		if !stop {
+			if stop, err = cut(commit); err != nil {
+				return
+			}
+		}
+		if stop {
+			if len(commit.Parents) > 0 {
+				n.boundary[string(it.hash)] = true
+				if !n.clientShallow[string(it.hash)] {
+					shallow = append(shallow, it.hash)
+				}
+			}
+			continue
+		}
+		if n.clientShallow[string(it.hash)] {
+			n.unshallow = append(n.unshallow, it.hash)
+		}
+		depth := it.depth + 1
+		if n.deepenRelative && it.depth == 0 && !n.clientShallow[string(it.hash)] {
+			depth = 0
+		}
+		for i := range commit.Parents {
+			queue = append(queue, item{commit.Parents[i], depth})
+		}
+	}
+	return
+}
+
+// objects collects everything reachable from the wants but not from
+// the commits the client has in common with us
+func (n *negotiation) objects() (objects []git.Object, err error) {
+	if n.boundary == nil {
+		if _, err = n.shallow(); err != nil {
+			return
+		}
+	}
+	walker := n.walker()
+	// the client has the content of the common commits...
+	var commonTrees []git.Hash
+	for i := range n.common {
+		if obj, err := readObject(n.srv, n.common[i]); err == nil {
+			if commit, ok := obj.(*git.Commit); ok {
+				commonTrees = append(commonTrees, commit.Tree)
+			}
+		}
+	}
+	if err = walker.Walk(commonTrees, nil); err != nil {
+		return
+	}
+	// ...and every commit reachable from them, down to its shallow
+	// commits
+	walker.Shallow = n.clientShallow
+	walker.Filter = func(git.Object, int) bool { return false }
+	if err = walker.Walk(n.common, nil); err != nil {
+		return
+	}
+
+	walker.Shallow = n.boundary
+	walker.Filter = n.filter.allow
+	collect := func(obj git.Object) error {
+		objects = append(objects, obj)
+		return nil
+	}
+	if err = walker.Walk(n.wants, collect); err != nil {
+		return
+	}
+	// the history behind commits that are no longer shallow has to be
+	// sent as well
+	for i := range n.unshallow {
+		var obj git.Object
+		if obj, err = readObject(n.srv, n.unshallow[i]); err != nil {
+			return
+		}
+		if commit, ok := obj.(*git.Commit); ok {
+			if err = walker.Walk(commit.Parents, collect); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// uploadPack serves an upload-pack request. Over stateless connections
+// (smart HTTP) the client resends its wants and all the haves found to be
+// common so far with every request, and either ends it with a flush to
+// continue the negotiation or with "done" to receive the packfile. Over
+// stateful ones (git://) the whole negotiation happens in one exchange.
+func uploadPack(srv *context.T, reponame string, r io.Reader, w io.Writer, stateless bool, log log15.Logger) {
+	dec := pktline.NewDecoder(r)
+	enc := pktline.NewEncoder(w)
+	n := newNegotiation(srv, reponame)
+	wantsRcvd := false
+	gotCommon, gotOther := false, false
+	var last git.Hash
+
+	for {
+		var line []byte
+		if err := dec.Decode(&line); err != nil {
+			if err != io.EOF || !wantsRcvd {
+				log.Error("error while decoding pkt-line", "err", err)
+			}
+			return // a deepening client may only send its wants
+		}
+		line = bytes.TrimSuffix(line, []byte{'\n'})
+		if ok, err := n.request(line); ok {
+			if err != nil {
+				enc.Encode([]byte(fmt.Sprintf("ERR %v\n", err)))
+				return
+			}
+			continue
+		}
+		switch {
+		case line == nil && !wantsRcvd:
+			wantsRcvd = true
+			if n.deepening() {
+				shallow, err := n.shallow()
+				if err != nil {
+					enc.Encode([]byte(fmt.Sprintf("ERR %v\n", err)))
+					return
+				}
+				for i := range shallow {
+					enc.Encode([]byte(fmt.Sprintf("shallow %s\n", shallow[i])))
+				}
+				for i := range n.unshallow {
+					enc.Encode([]byte(fmt.Sprintf("unshallow %s\n", n.unshallow[i])))
+				}
+				enc.Encode(nil)
+			}
+		case line == nil:
+			if n.multiAck == multiAckDetailed && gotCommon && !gotOther && n.okToGiveUp() {
+				enc.Encode([]byte(fmt.Sprintf("ACK %s ready\n", last)))
+			}
+			if len(n.common) == 0 || n.multiAck != multiAckNone {
+				enc.Encode([]byte("NAK\n"))
+			}
+			if stateless {
+				return // the client will come back with another request
+			}
+			gotCommon, gotOther = false, false
+		case bytes.Compare(line, []byte("done")) == 0:
+			if len(n.common) > 0 && n.multiAck != multiAckNone {
+				enc.Encode([]byte(fmt.Sprintf("ACK %s\n", last)))
+			} else if len(n.common) == 0 {
+				enc.Encode([]byte("NAK\n"))
+			}
+			goto done
+		default:
+			split := bytes.Split(line, []byte{' '})
+			if len(split) < 2 {
+				enc.Encode([]byte(fmt.Sprintf("ERR unexpected line %q\n", line)))
+				return
+			}
+			hash, err := hex.DecodeString(string(split[1]))
+			if err != nil || len(hash) != 20 {
+				enc.Encode([]byte(fmt.Sprintf("ERR error parsing hash %s\n", split[1])))
+				return
+			}
+			switch string(split[0]) {
+			case "want":
+				if ok, err := reachable(srv, reponame, hash); !ok {
+					log.Info("refused unreachable want", "repo", reponame, "want", git.Hash(hash), "err", err)
+					enc.Encode([]byte(fmt.Sprintf("ERR upload-pack: not our ref %s\n", split[1])))
+					return
+				}
+				n.want(hash, split[2:])
+			case "have":
+				if n.have(hash) {
+					gotCommon = true
+					last = hash
+					switch n.multiAck {
+					case multiAckDetailed:
+						enc.Encode([]byte(fmt.Sprintf("ACK %s common\n", last)))
+					case multiAck:
+						enc.Encode([]byte(fmt.Sprintf("ACK %s continue\n", last)))
+					default:
+						if len(n.common) == 1 {
+							enc.Encode([]byte(fmt.Sprintf("ACK %s\n", last)))
+						}
+					}
+				} else {
+					gotOther = true
+					if n.multiAck != multiAckNone && n.okToGiveUp() {
+						if n.multiAck == multiAckDetailed {
+							enc.Encode([]byte(fmt.Sprintf("ACK %x ready\n", hash)))
+						} else {
+							enc.Encode([]byte(fmt.Sprintf("ACK %x continue\n", hash)))
+						}
+					}
+				}
+			}
+		}
+	}
+done:
+	objects, err := n.objects()
+	if err != nil {
+		log.Error("error while collecting objects", "err", err)
+		enc.Encode(append([]byte{3}, []byte(fmt.Sprintf("%s", err))...))
+		return
+	}
+
+	var pw io.Writer = w
+	switch {
+	case n.caps["side-band-64k"]:
+		pw = &sidebandWriter{writer: &pktlineWriter{encoder: enc}, band: 1, max: 65515}
+	case n.caps["side-band"]:
+		pw = &sidebandWriter{writer: &pktlineWriter{encoder: enc}, band: 1, max: 999}
+	}
+	err = git.WritePackfile(pw, git.NewPackfile(objects))
+	if err != nil {
+		log.Error("error while sending packfile", "err", err)
+		enc.Encode(append([]byte{3}, []byte(fmt.Sprintf("%s", err))...))
+		return
+	}
+	if pw != w {
+		enc.Encode(nil)
+	}
+}
@@ -3,11 +3,13 @@ package net
 import (
 	"bytes"
 	"encoding/gob"
-	"path"
+	"sync"
+	"time"
 
 	"github.com/inconshreveable/log15"
 	"github.com/spx/gitchain/git"
 	"github.com/spx/gitchain/server/context"
+	"github.com/spx/gitchain/server/objects"
 	"github.com/spx/gitchain/transaction"
 	"github.com/spx/wendy"
 )
@@ -16,6 +18,49 @@ type GitchainApp struct {
 	cluster *wendy.Cluster
 	log     log15.Logger
 	srv     *context.T
+	// object requests waiting for a response, by hash
+	pending     map[string][]pendingRequest
+	pendingLock sync.Mutex
+	replicator  *replicator
+	challenger  *challenger
+}
+
+type pendingRequest struct {
+	request *objects.Request
+	expires time.Time
+}
+
+// expect registers an object request, telling whether it has to be sent
+// over the network (it doesn't if the object has already been requested)
+func (app *GitchainApp) expect(req *objects.Request) bool {
+	app.pendingLock.Lock()
+	defer app.pendingLock.Unlock()
+	now := time.Now()
+	// forget the requests nobody responded to
+	for h, reqs := range app.pending {
+		if now.After(reqs[len(reqs)-1].expires) {
+			delete(app.pending, h)
+		}
+	}
+	reqs := app.pending[string(req.Hash)]
+	expires := now.Add(time.Duration(app.srv.Config.Network.ObjectTimeout) * time.Second)
+	app.pending[string(req.Hash)] = append(reqs, pendingRequest{request: req, expires: expires})
+	return len(reqs) == 0
+}
+
+// respond passes an object (or nil if it wasn't found) to everyone
+// who requested it
+func (app *GitchainApp) respond(h []byte, obj git.Object) {
+	app.pendingLock.Lock()
+	reqs := app.pending[string(h)]
+	delete(app.pending, string(h))
+	app.pendingLock.Unlock()
+	for i := range reqs {
+		select {
+		case reqs[i].request.ResponseChannel <- obj:
+		default:
+		}
+	}
 }
 
 func (app *GitchainApp) OnError(err error) {
@@ -90,10 +135,85 @@ func (app *GitchainApp) OnDeliver(msg wendy.Message) {
 		switch {
 		case msg.Purpose&MSG_OBJECT != 0:
 			obj := git.DecodeObject(msg.Value)
-			err = git.WriteObject(obj, path.Join(app.srv.Config.General.DataPath, "objects"))
+			if obj == nil {
+				log.Error("received a malformed object")
+				return
+			}
+			err = git.WriteObject(obj, objects.Dir(app.srv))
 			if err != nil {
 				log.Error("error while writing object", "obj", obj, "err", err)
+				return
+			}
+			targets, err := app.replicator.track(obj.Hash())
+			if err != nil {
+				log.Error("error while tracking object", "obj", obj, "err", err)
+				return
+			}
+			if msg.Purpose&MSG_REPLICA == 0 {
+				for i := range targets {
+					app.sendReplica(targets[i], obj)
+				}
+			}
+		case msg.Purpose&MSG_OBJECT_REQUEST != 0:
+			response := objectResponse{Hash: msg.Value}
+			if obj, err := objects.ReadLocal(app.srv, msg.Value); err == nil {
+				response.Object = git.ObjectToBytes(obj)
+			}
+			var buf bytes.Buffer
+			if err = gob.NewEncoder(&buf).Encode(response); err != nil {
+				log.Error("error while encoding object response", "err", err)
+				return
+			}
+			wmsg := app.cluster.NewMessage(MSG_REGULAR|MSG_OBJECT_RESPONSE, msg.Sender.ID, buf.Bytes())
+			if err = app.cluster.Send(wmsg); err != nil {
+				log.Error("error sending object response", "err", err)
+			}
+		case msg.Purpose&MSG_STORAGE_PROOF == MSG_STORAGE_PROOF:
+			var proof storageProof
+			if err = gob.NewDecoder(bytes.NewBuffer(msg.Value)).Decode(&proof); err != nil {
+				log.Error("error while decoding storage proof", "err", err)
+				return
+			}
+			valid, known := app.challenger.verify(msg.Sender.ID, proof)
+			switch {
+			case !known:
+				log.Warn("received an unexpected storage proof", "node", msg.Sender.ID)
+			case valid:
+				app.replicator.succeeded(msg.Sender.ID)
+			default:
+				log.Warn("node failed a storage challenge", "node", msg.Sender.ID)
+				go app.replicate(app.replicator.failed(msg.Sender.ID))
+			}
+		case msg.Purpose&MSG_STORAGE_CHALLENGE != 0:
+			var challenge storageChallenge
+			if err = gob.NewDecoder(bytes.NewBuffer(msg.Value)).Decode(&challenge); err != nil {
+				log.Error("error while decoding storage challenge", "err", err)
+				return
+			}
+			proof := storageProof{Nonce: challenge.Nonce}
+			if obj, err := objects.ReadLocal(app.srv, challenge.Hash); err == nil {
+				proof.Proof, _ = prove(challenge, git.ObjectToBytes(obj))
 			}
+			var buf bytes.Buffer
+			if err = gob.NewEncoder(&buf).Encode(proof); err != nil {
+				log.Error("error while encoding storage proof", "err", err)
+				return
+			}
+			wmsg := app.cluster.NewMessage(MSG_REGULAR|MSG_STORAGE_PROOF, msg.Sender.ID, buf.Bytes())
+			if err = app.cluster.Send(wmsg); err != nil {
+				log.Error("error sending storage proof", "err", err)
+			}
+		case msg.Purpose&MSG_OBJECT_RESPONSE != 0:
+			var response objectResponse
+			if err = gob.NewDecoder(bytes.NewBuffer(msg.Value)).Decode(&response); err != nil {
+				log.Error("error while decoding object response", "err", err)
+				return
+			}
+			var obj git.Object
+			if len(response.Object) > 0 {
+				obj = git.DecodeObject(response.Object)
+			}
+			app.respond(response.Hash, obj)
 		}
 	}
 }
@@ -102,7 +222,65 @@ func (app *GitchainApp) OnForward(msg *wendy.Message, next wendy.NodeID) bool {
 	return true
 }
 
+func (app *GitchainApp) sendReplica(id wendy.NodeID, obj git.Object) {
+	msg := app.cluster.NewMessage(MSG_REGULAR|MSG_OBJECT|MSG_REPLICA, id, git.ObjectToBytes(obj))
+	if err := app.cluster.Send(msg); err != nil {
+		app.log.Error("error sending object replica", "obj", obj, "node", id, "err", err)
+	}
+}
+
+// replicate sends the objects this node is in charge of to the nodes that
+// should be holding them now
+func (app *GitchainApp) replicate(transfers map[wendy.NodeID][]git.Hash) {
+	for id, hashes := range transfers {
+		app.log.Debug("replicating objects", "node", id, "objects", len(hashes))
+		for i := range hashes {
+			obj, err := objects.ReadLocal(app.srv, hashes[i])
+			if err != nil {
+				app.log.Error("error reading object to replicate", "hash", hashes[i], "err", err)
+				continue
+			}
+			app.sendReplica(id, obj)
+		}
+	}
+}
+
+// challenge asks a node holding one of our objects to prove it still
+// stores it, and gives up on the nodes that didn't answer previous
+// challenges in time
+func (app *GitchainApp) challenge() {
+	for _, id := range app.challenger.expired() {
+		app.log.Warn("node didn't answer a storage challenge", "node", id)
+		app.replicate(app.replicator.failed(id))
+	}
+	h, id, ok := app.replicator.challengeTarget()
+	if !ok {
+		return
+	}
+	obj, err := objects.ReadLocal(app.srv, h)
+	if err != nil {
+		app.log.Error("error reading challenged object", "hash", h, "err", err)
+		return
+	}
+	challenge, proof, err := newChallenge(obj)
+	if err != nil {
+		app.log.Error("error preparing storage challenge", "obj", obj, "err", err)
+		return
+	}
+	var buf bytes.Buffer
+	if err = gob.NewEncoder(&buf).Encode(challenge); err != nil {
+		app.log.Error("error while encoding storage challenge", "err", err)
+		return
+	}
+	app.challenger.expect(id, challenge, proof, time.Duration(app.srv.Config.Network.ObjectTimeout)*time.Second)
+	msg := app.cluster.NewMessage(MSG_REGULAR|MSG_STORAGE_CHALLENGE, id, buf.Bytes())
+	if err = app.cluster.Send(msg); err != nil {
+		app.log.Error("error sending storage challenge", "node", id, "err", err)
+	}
+}
+
 func (app *GitchainApp) OnNewLeaves(leaves []*wendy.Node) {
+	go app.replicate(app.replicator.setLeaves(leaves))
 }
 
 func (app *GitchainApp) OnNodeJoin(node wendy.Node) {
@@ -111,6 +289,7 @@ func (app *GitchainApp) OnNodeJoin(node wendy.Node) {
 
 func (app *GitchainApp) OnNodeExit(node wendy.Node) {
 	app.log.Info("node left", "node", node.ID)
+	go app.replicate(app.replicator.removeLeaf(node.ID))
 }
 
 func (app *GitchainApp) OnHeartbeat(node wendy.Node) {
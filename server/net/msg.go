@@ -14,6 +14,16 @@ const (
 	MSG_REPLY       byte = MSG_BROADCAST | MSG_REGULAR
 	MSG_TRANSACTION byte = 0x01
 	MSG_OBJECT      byte = 0x02
+	// object lookups are sent to the node responsible for the
+	// object, which replies directly to the sender
+	MSG_OBJECT_REQUEST  byte = 0x04
+	MSG_OBJECT_RESPONSE byte = 0x08
+	// replicas sent by the node responsible for an object
+	// aren't replicated any further
+	MSG_REPLICA byte = 0x10
+	// proofs of storage are responses to storage challenges
+	MSG_STORAGE_CHALLENGE byte = 0x20
+	MSG_STORAGE_PROOF     byte = MSG_STORAGE_CHALLENGE | MSG_OBJECT_RESPONSE
 )
 
 type HashableEncodable interface {
@@ -21,6 +31,11 @@ type HashableEncodable interface {
 	Encode() ([]byte, error)
 }
 
+type objectResponse struct {
+	Hash   []byte
+	Object []byte // empty when the object wasn't found
+}
+
 type broadcastEnvelope struct {
 	Content []byte
 	Limit   wendy.NodeID
@@ -28,6 +43,7 @@ type broadcastEnvelope struct {
 
 func init() {
 	gob.Register(broadcastEnvelope{})
+	gob.Register(objectResponse{})
 }
 
 func broadcast(c *wendy.Cluster, msg HashableEncodable, purpose byte) (err error) {
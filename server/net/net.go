@@ -4,10 +4,12 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/inconshreveable/log15"
 	"github.com/spx/gitchain/git"
 	"github.com/spx/gitchain/server/context"
+	"github.com/spx/gitchain/server/objects"
 	"github.com/spx/gitchain/transaction"
 	"github.com/spx/gitchain/util"
 	"github.com/spx/wendy"
@@ -18,6 +20,8 @@ func Server(srv *context.T) {
 	ch := srv.Router.Sub("/dht/join")
 	tch := srv.Router.Sub("/transaction/mem")
 	och := srv.Router.Sub("/git/object")
+	rch := srv.Router.Sub("/git/object/request")
+	dch := srv.Router.Sub("/git/object/removed")
 
 	keyAuth, err := newKeyAuth()
 	if err != nil {
@@ -38,12 +42,30 @@ func Server(srv *context.T) {
 
 	cluster := wendy.NewCluster(node, keyAuth)
 	cluster.SetLogLevel(wendy.LogLevelError)
-	cluster.RegisterCallback(&GitchainApp{cluster: cluster, log: log.New(), srv: srv})
+	app := &GitchainApp{cluster: cluster, log: log.New(), srv: srv, pending: make(map[string][]pendingRequest),
+		replicator: newReplicator(id, srv.Config.Network.Replicas), challenger: newChallenger()}
+	// we don't know who else holds the objects stored so far, they will
+	// be replicated once we learn about our neighbours
+	stored, err := objects.List(srv)
+	if err != nil {
+		log.Error("error listing stored objects", "err", err)
+	}
+	for i := range stored {
+		app.replicator.track(stored[i])
+	}
+	cluster.RegisterCallback(app)
 	go cluster.Listen()
 	defer cluster.Stop()
 
 	log.Info("node started")
 
+	var challenges <-chan time.Time
+	if srv.Config.Network.ChallengeInterval > 0 {
+		ticker := time.NewTicker(time.Duration(srv.Config.Network.ChallengeInterval) * time.Second)
+		defer ticker.Stop()
+		challenges = ticker.C
+	}
+
 	for i := range srv.Config.Network.Join {
 		log.Info("scheduling a connection", "addr", srv.Config.Network.Join[i])
 		srv.Router.Pub(srv.Config.Network.Join[i], "/dht/join")
@@ -82,7 +104,7 @@ loop:
 		}
 	case obji := <-och:
 		if obj, ok := obji.(git.Object); ok {
-			id, err := wendy.NodeIDFromBytes(util.SHA256(obj.Hash()))
+			id, err := app.replicator.firstHop(obj.Hash())
 			if err != nil {
 				log15.Error("error preparing msg id for a git object", "obj", obj, "err", err)
 			} else {
@@ -92,6 +114,29 @@ loop:
 				}
 			}
 		}
+	case hi := <-dch:
+		if h, ok := hi.(git.Hash); ok {
+			app.replicator.untrack(h)
+		}
+	case <-challenges:
+		app.challenge()
+	case reqi := <-rch:
+		if req, ok := reqi.(*objects.Request); ok {
+			if !app.expect(req) {
+				goto loop // already requested
+			}
+			id, err := wendy.NodeIDFromBytes(util.SHA256(req.Hash))
+			if err != nil {
+				log.Error("error preparing msg id for a git object request", "hash", req.Hash, "err", err)
+				app.respond(req.Hash, nil)
+				goto loop
+			}
+			msg := cluster.NewMessage(MSG_REGULAR|MSG_OBJECT_REQUEST, id, req.Hash)
+			if err = cluster.Send(msg); err != nil {
+				log.Error("error requesting git object", "hash", req.Hash, "err", err)
+				app.respond(req.Hash, nil)
+			}
+		}
 	}
 	goto loop
 }
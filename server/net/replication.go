@@ -0,0 +1,242 @@
+package net
+
+import (
+	"math/big"
+	mrand "math/rand"
+	"sort"
+	"sync"
+
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/util"
+	"github.com/spx/wendy"
+)
+
+// ringSize is the size of the node ID space (IDs are 128 bits long)
+var ringSize = new(big.Int).Lsh(big.NewInt(1), 128)
+
+func idToInt(id wendy.NodeID) *big.Int {
+	i := new(big.Int).SetUint64(id[0])
+	i.Lsh(i, 64)
+	return i.Or(i, new(big.Int).SetUint64(id[1]))
+}
+
+// distance between two IDs, going either way around the ring
+func distance(a, b wendy.NodeID) *big.Int {
+	d := new(big.Int).Sub(idToInt(a), idToInt(b))
+	d.Abs(d)
+	if other := new(big.Int).Sub(ringSize, d); other.Cmp(d) < 0 {
+		return other
+	}
+	return d
+}
+
+type byDistance struct {
+	ids []wendy.NodeID
+	key wendy.NodeID
+}
+
+func (s byDistance) Len() int      { return len(s.ids) }
+func (s byDistance) Swap(i, j int) { s.ids[i], s.ids[j] = s.ids[j], s.ids[i] }
+func (s byDistance) Less(i, j int) bool {
+	return distance(s.ids[i], s.key).Cmp(distance(s.ids[j], s.key)) < 0
+}
+
+func objectKey(h git.Hash) (wendy.NodeID, error) {
+	return wendy.NodeIDFromBytes(util.SHA256(h))
+}
+
+type replicaSet struct {
+	key     wendy.NodeID
+	holders []wendy.NodeID
+}
+
+// replicator keeps track of the objects this node stores and of the nodes
+// holding their replicas, so that they can be handed over to other nodes
+// when the neighbourhood changes
+type replicator struct {
+	lock     sync.Mutex
+	self     wendy.NodeID
+	replicas int
+	leaves   map[wendy.NodeID]bool
+	objects  map[string]*replicaSet
+	// consecutive storage challenges failed by each node
+	failures map[wendy.NodeID]int
+}
+
+func newReplicator(self wendy.NodeID, replicas int) *replicator {
+	if replicas < 1 {
+		replicas = 1
+	}
+	return &replicator{self: self, replicas: replicas,
+		leaves:   make(map[wendy.NodeID]bool),
+		objects:  make(map[string]*replicaSet),
+		failures: make(map[wendy.NodeID]int)}
+}
+
+// usable tells whether objects can be placed on a node
+func (r *replicator) usable(id wendy.NodeID) bool {
+	return id == r.self || (r.leaves[id] && r.failures[id] < MAX_CHALLENGE_FAILURES)
+}
+
+// closest returns the nodes (including this one) closest to key, out of
+// those known to this node
+func (r *replicator) closest(key wendy.NodeID, n int) []wendy.NodeID {
+	ids := []wendy.NodeID{r.self}
+	for id := range r.leaves {
+		if r.usable(id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Sort(byDistance{ids: ids, key: key})
+	if len(ids) > n {
+		ids = ids[0:n]
+	}
+	return ids
+}
+
+// firstHop returns where to send a new object to: its key, for it to be
+// routed to the node closest to it, unless that node is known to be
+// failing, in which case the closest usable node is addressed instead
+func (r *replicator) firstHop(h git.Hash) (wendy.NodeID, error) {
+	key, err := objectKey(h)
+	if err != nil {
+		return key, err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	ids := []wendy.NodeID{r.self}
+	for id := range r.leaves {
+		ids = append(ids, id)
+	}
+	sort.Sort(byDistance{ids: ids, key: key})
+	if r.usable(ids[0]) {
+		return key, nil
+	}
+	return r.closest(key, 1)[0], nil
+}
+
+func contains(ids []wendy.NodeID, id wendy.NodeID) bool {
+	for i := range ids {
+		if ids[i] == id {
+			return true
+		}
+	}
+	return false
+}
+
+// track records an object stored on this node, returning the nodes that
+// should receive a replica of it
+func (r *replicator) track(h git.Hash) ([]wendy.NodeID, error) {
+	key, err := objectKey(h)
+	if err != nil {
+		return nil, err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var targets []wendy.NodeID
+	holders := r.closest(key, r.replicas)
+	for i := range holders {
+		if holders[i] != r.self {
+			targets = append(targets, holders[i])
+		}
+	}
+	r.objects[string(h)] = &replicaSet{key: key, holders: append(targets, r.self)}
+	return targets, nil
+}
+
+// untrack forgets about an object no longer stored on this node
+func (r *replicator) untrack(h git.Hash) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.objects, string(h))
+}
+
+// setLeaves replaces the leaf set, returning the objects to be sent
+// to each node to restore the replication factor
+func (r *replicator) setLeaves(leaves []*wendy.Node) map[wendy.NodeID][]git.Hash {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.leaves = make(map[wendy.NodeID]bool)
+	for i := range leaves {
+		if leaves[i] != nil && leaves[i].ID != r.self {
+			r.leaves[leaves[i].ID] = true
+		}
+	}
+	return r.rebalance()
+}
+
+// removeLeaf forgets about a node that left the cluster, returning the
+// objects to be sent to each node to restore the replication factor
+func (r *replicator) removeLeaf(id wendy.NodeID) map[wendy.NodeID][]git.Hash {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.leaves, id)
+	return r.rebalance()
+}
+
+// failed records a failed storage challenge, returning the objects to be
+// sent to each node if the failing node is no longer trusted with them
+func (r *replicator) failed(id wendy.NodeID) map[wendy.NodeID][]git.Hash {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.failures[id]++
+	if r.failures[id] != MAX_CHALLENGE_FAILURES {
+		return nil
+	}
+	return r.rebalance()
+}
+
+// succeeded records a successful storage challenge
+func (r *replicator) succeeded(id wendy.NodeID) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.failures[id] < MAX_CHALLENGE_FAILURES {
+		delete(r.failures, id)
+	}
+}
+
+// challengeTarget picks an object stored by this node along with another
+// node supposed to hold it
+func (r *replicator) challengeTarget() (h git.Hash, node wendy.NodeID, ok bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for hash, set := range r.objects { // map iteration order is random
+		var candidates []wendy.NodeID
+		for _, id := range set.holders {
+			if id != r.self && r.usable(id) {
+				candidates = append(candidates, id)
+			}
+		}
+		if len(candidates) > 0 {
+			return git.Hash(hash), candidates[mrand.Intn(len(candidates))], true
+		}
+	}
+	return
+}
+
+func (r *replicator) rebalance() map[wendy.NodeID][]git.Hash {
+	transfers := make(map[wendy.NodeID][]git.Hash)
+	for h, set := range r.objects {
+		var alive []wendy.NodeID
+		for _, id := range set.holders {
+			if r.usable(id) {
+				alive = append(alive, id)
+			}
+		}
+		holders := r.closest(set.key, r.replicas)
+		// the remaining holder closest to the object hands it over
+		sort.Sort(byDistance{ids: alive, key: set.key})
+		if len(alive) > 0 && alive[0] == r.self {
+			for _, id := range holders {
+				if !contains(alive, id) {
+					transfers[id] = append(transfers[id], git.Hash(h))
+				}
+			}
+		}
+		if !contains(holders, r.self) {
+			holders = append(holders, r.self)
+		}
+		set.holders = holders
+	}
+	return transfers
+}
@@ -0,0 +1,101 @@
+package net
+
+import (
+	"testing"
+
+	"github.com/spx/gitchain/git"
+	"github.com/spx/wendy"
+	"github.com/stretchr/testify/assert"
+)
+
+// fixtureNodeID returns a node ID at a given distance from key
+func fixtureNodeID(key wendy.NodeID, distance uint64) wendy.NodeID {
+	id := key
+	id[0] ^= distance
+	return id
+}
+
+func TestFirstHop(t *testing.T) {
+	h := git.Hash("0123456789abcdef0123")
+	key, err := objectKey(h)
+	if err != nil {
+		t.Errorf("error while computing object key: %v", err)
+	}
+	self := fixtureNodeID(key, 1<<40)
+	near := fixtureNodeID(key, 1)
+	far := fixtureNodeID(key, 1<<20)
+
+	for _, c := range []struct {
+		name     string
+		leaves   []wendy.NodeID
+		failing  []wendy.NodeID
+		expected wendy.NodeID
+	}{
+		{"alone", nil, nil, key},
+		{"closest leaf usable", []wendy.NodeID{near, far}, nil, key},
+		{"closest leaf failing", []wendy.NodeID{near, far}, []wendy.NodeID{near}, far},
+		{"all leaves failing", []wendy.NodeID{near, far}, []wendy.NodeID{near, far}, self},
+		{"farther leaf failing", []wendy.NodeID{near, far}, []wendy.NodeID{far}, key},
+	} {
+		r := newReplicator(self, 2)
+		var leaves []*wendy.Node
+		for i := range c.leaves {
+			leaves = append(leaves, &wendy.Node{ID: c.leaves[i]})
+		}
+		r.setLeaves(leaves)
+		for _, id := range c.failing {
+			for i := 0; i < MAX_CHALLENGE_FAILURES; i++ {
+				r.failed(id)
+			}
+		}
+		hop, err := r.firstHop(h)
+		assert.Nil(t, err, c.name)
+		assert.Equal(t, hop, c.expected, c.name)
+	}
+}
+
+func TestTrackSkipsFailingNodes(t *testing.T) {
+	h := git.Hash("0123456789abcdef0123")
+	key, _ := objectKey(h)
+	self := fixtureNodeID(key, 1<<40)
+	near := fixtureNodeID(key, 1)
+	far := fixtureNodeID(key, 1<<20)
+
+	for _, c := range []struct {
+		name     string
+		failures int
+		expected []wendy.NodeID
+	}{
+		{"no failures", 0, []wendy.NodeID{near, far}},
+		{"a failure", 1, []wendy.NodeID{near, far}},
+		{"too many failures", MAX_CHALLENGE_FAILURES, []wendy.NodeID{far}},
+	} {
+		r := newReplicator(self, 3)
+		r.setLeaves([]*wendy.Node{{ID: near}, {ID: far}})
+		for i := 0; i < c.failures; i++ {
+			r.failed(near)
+		}
+		targets, err := r.track(h)
+		assert.Nil(t, err, c.name)
+		assert.Equal(t, targets, c.expected, c.name)
+	}
+}
+
+func TestFailedRebalances(t *testing.T) {
+	h := git.Hash("0123456789abcdef0123")
+	key, _ := objectKey(h)
+	self := fixtureNodeID(key, 1)
+	near := fixtureNodeID(key, 1<<10)
+	far := fixtureNodeID(key, 1<<20)
+
+	r := newReplicator(self, 2)
+	r.setLeaves([]*wendy.Node{{ID: near}, {ID: far}})
+	targets, _ := r.track(h)
+	assert.Equal(t, targets, []wendy.NodeID{near})
+
+	for i := 1; i < MAX_CHALLENGE_FAILURES; i++ {
+		assert.Empty(t, r.failed(near))
+	}
+	// the replica is handed over once the node is no longer trusted
+	assert.Equal(t, r.failed(near), map[wendy.NodeID][]git.Hash{far: {h}})
+}
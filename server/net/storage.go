@@ -0,0 +1,115 @@
+// Proof-of-storage challenges
+package net
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/gob"
+	"fmt"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/util"
+	"github.com/spx/wendy"
+)
+
+// MAX_CHALLENGE_FAILURES is the number of consecutive failed challenges
+// after which a node is no longer trusted with objects
+const MAX_CHALLENGE_FAILURES = 3
+
+type storageChallenge struct {
+	Nonce  []byte
+	Hash   []byte
+	Offset int
+	Length int
+}
+
+type storageProof struct {
+	Nonce []byte
+	Proof []byte // empty when the object isn't stored
+}
+
+func init() {
+	gob.Register(storageChallenge{})
+	gob.Register(storageProof{})
+}
+
+// prove computes the answer to a challenge for an object's content:
+// nodes holding a replica of an object are periodically asked to hash a
+// random byte range of it together with a nonce, which can't be done
+// without storing the object itself
+func prove(c storageChallenge, content []byte) ([]byte, error) {
+	if c.Offset < 0 || c.Length <= 0 || c.Offset+c.Length > len(content) {
+		return nil, fmt.Errorf("challenged range %d+%d is out of bounds", c.Offset, c.Length)
+	}
+	return util.SHA256(append(append([]byte{}, c.Nonce...), content[c.Offset:c.Offset+c.Length]...)), nil
+}
+
+// newChallenge prepares a challenge for an object, along with the
+// expected proof
+func newChallenge(obj git.Object) (c storageChallenge, proof []byte, err error) {
+	content := git.ObjectToBytes(obj)
+	c.Nonce = make([]byte, 32)
+	if _, err = rand.Read(c.Nonce); err != nil {
+		return
+	}
+	c.Hash = obj.Hash()
+	c.Offset = mrand.Intn(len(content))
+	c.Length = 1 + mrand.Intn(len(content)-c.Offset)
+	proof, err = prove(c, content)
+	return
+}
+
+type pendingChallenge struct {
+	node    wendy.NodeID
+	hash    []byte
+	proof   []byte
+	expires time.Time
+}
+
+// challenger keeps track of the challenges awaiting a proof
+type challenger struct {
+	lock    sync.Mutex
+	pending map[string]*pendingChallenge
+}
+
+func newChallenger() *challenger {
+	return &challenger{pending: make(map[string]*pendingChallenge)}
+}
+
+func (c *challenger) expect(node wendy.NodeID, challenge storageChallenge, proof []byte, timeout time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.pending[string(challenge.Nonce)] = &pendingChallenge{node: node, hash: challenge.Hash, proof: proof,
+		expires: time.Now().Add(timeout)}
+}
+
+// verify checks a proof received from a node, returning false if it
+// doesn't answer any pending challenge
+func (c *challenger) verify(node wendy.NodeID, p storageProof) (valid bool, known bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	challenge, ok := c.pending[string(p.Nonce)]
+	if !ok || challenge.node != node {
+		return false, false
+	}
+	delete(c.pending, string(p.Nonce))
+	return bytes.Compare(challenge.proof, p.Proof) == 0, true
+}
+
+// expired removes the challenges that haven't been answered in time,
+// returning the nodes that failed them
+func (c *challenger) expired() (nodes []wendy.NodeID) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	now := time.Now()
+	for nonce, challenge := range c.pending {
+		if now.After(challenge.expires) {
+			nodes = append(nodes, challenge.node)
+			delete(c.pending, nonce)
+		}
+	}
+	return
+}
@@ -0,0 +1,78 @@
+package net
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spx/gitchain/git"
+	"github.com/spx/wendy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProve(t *testing.T) {
+	content := []byte("0123456789")
+	for _, c := range []struct {
+		offset, length int
+		valid          bool
+	}{
+		{0, 10, true},
+		{9, 1, true},
+		{0, 0, false},
+		{-1, 2, false},
+		{5, 6, false},
+	} {
+		_, err := prove(storageChallenge{Nonce: []byte{1}, Offset: c.offset, Length: c.length}, content)
+		assert.Equal(t, err == nil, c.valid, "%d+%d", c.offset, c.length)
+	}
+}
+
+func TestChallengeVerification(t *testing.T) {
+	obj := &git.Blob{Content: []byte("stored object\n")}
+	other := &git.Blob{Content: []byte("another object\n")}
+	node, impostor := wendy.NodeID{1, 1}, wendy.NodeID{2, 2}
+
+	challenge, proof, err := newChallenge(obj)
+	if err != nil {
+		t.Errorf("error while preparing challenge: %v", err)
+	}
+	otherProof, _ := prove(storageChallenge{Nonce: challenge.Nonce, Offset: 0, Length: 1}, git.ObjectToBytes(other))
+
+	for _, c := range []struct {
+		name         string
+		node         wendy.NodeID
+		proof        storageProof
+		valid, known bool
+	}{
+		{"correct proof", node, storageProof{Nonce: challenge.Nonce, Proof: proof}, true, true},
+		{"wrong proof", node, storageProof{Nonce: challenge.Nonce, Proof: otherProof}, false, true},
+		{"object not stored", node, storageProof{Nonce: challenge.Nonce}, false, true},
+		{"unknown nonce", node, storageProof{Nonce: []byte("nonce"), Proof: proof}, false, false},
+		{"another node", impostor, storageProof{Nonce: challenge.Nonce, Proof: proof}, false, false},
+	} {
+		ch := newChallenger()
+		ch.expect(node, challenge, proof, time.Minute)
+		valid, known := ch.verify(c.node, c.proof)
+		assert.Equal(t, valid, c.valid, c.name)
+		assert.Equal(t, known, c.known, c.name)
+	}
+
+	// a challenge is only answered once
+	ch := newChallenger()
+	ch.expect(node, challenge, proof, time.Minute)
+	valid, _ := ch.verify(node, storageProof{Nonce: challenge.Nonce, Proof: proof})
+	assert.True(t, valid)
+	_, known := ch.verify(node, storageProof{Nonce: challenge.Nonce, Proof: proof})
+	assert.False(t, known)
+}
+
+func TestChallengeExpiry(t *testing.T) {
+	obj := &git.Blob{Content: []byte("stored object\n")}
+	node := wendy.NodeID{1, 1}
+	ch := newChallenger()
+	challenge, proof, _ := newChallenge(obj)
+	ch.expect(node, challenge, proof, -time.Second)
+	assert.Equal(t, ch.expired(), []wendy.NodeID{node})
+	assert.Empty(t, ch.expired())
+	_, known := ch.verify(node, storageProof{Nonce: challenge.Nonce, Proof: proof})
+	assert.False(t, known)
+}
@@ -0,0 +1,125 @@
+package objects
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/server/context"
+)
+
+// Objects stored more recently than this are never collected, they may
+// belong to a push whose reference updates haven't been mined yet
+const GC_GRACE_PERIOD = 14 * 24 * time.Hour
+
+// GCReport summarizes a garbage collection
+type GCReport struct {
+	Reachable int   // objects reachable from a reference
+	Recent    int   // unreachable objects kept for the grace period
+	Removed   int   // unreachable objects removed (or to be removed)
+	Freed     int64 // bytes freed (or to be freed)
+}
+
+var gcLock sync.Mutex
+
+// GC removes the objects that can't be reached from the references of any
+// repository and were stored more than grace ago. Nothing is removed in
+// a dry run. Removed objects are published on /git/object/removed.
+//
+// Only objects stored locally are walked, the others being left alone
+// rather than retrieved from the network. Objects only reachable through
+// them are kept if they are recorded as reachable from the references of
+// a repository.
+func GC(srv *context.T, grace time.Duration, dryRun bool) (*GCReport, error) {
+	gcLock.Lock()
+	defer gcLock.Unlock()
+
+	var tips []git.Hash
+	repos := srv.DB.ListRepositories()
+	for i := range repos {
+		refs, err := srv.DB.ListRefs(repos[i])
+		if err != nil {
+			return nil, err
+		}
+		for j := range refs {
+			ref, err := srv.DB.GetRef(repos[i], refs[j])
+			if err != nil {
+				return nil, err
+			}
+			tips = append(tips, git.Hash(ref))
+		}
+	}
+
+	report := &GCReport{}
+	walker := git.NewWalker(func(h git.Hash) (git.Object, error) {
+		if !Exists(srv, h) {
+			return nil, nil
+		}
+		obj, err := ReadLocal(srv, h)
+		if err != nil {
+			return nil, fmt.Errorf("object %s is unreadable: %v", h, err)
+		}
+		return obj, nil
+	})
+	err := walker.Walk(tips, func(obj git.Object) error {
+		report.Reachable++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := List(srv)
+	if err != nil {
+		return nil, err
+	}
+	for i := range stored {
+		if walker.Visited(stored[i]) {
+			continue
+		}
+		indexed, err := reachableFromRepositories(srv, repos, stored[i])
+		if err != nil {
+			return report, err
+		}
+		if indexed {
+			report.Reachable++
+			continue
+		}
+		// stat right before removing, the object may have been
+		// received again in the meantime
+		info, err := git.StatObject(stored[i], Dir(srv))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+		if time.Since(info.ModTime()) < grace {
+			report.Recent++
+			continue
+		}
+		if !dryRun {
+			if err = git.RemoveObject(stored[i], Dir(srv)); err != nil {
+				return report, err
+			}
+			srv.Router.Pub(stored[i], "/git/object/removed")
+		}
+		report.Removed++
+		report.Freed += info.Size()
+	}
+	return report, nil
+}
+
+// reachableFromRepositories tells whether an object is recorded as
+// reachable from the references of one of repos
+func reachableFromRepositories(srv *context.T, repos []string, h git.Hash) (bool, error) {
+	for i := range repos {
+		reachable, err := srv.DB.IsReachableObject(repos[i], h)
+		if err != nil || reachable {
+			return reachable, err
+		}
+	}
+	return false, nil
+}
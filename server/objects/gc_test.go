@@ -0,0 +1,80 @@
+package objects
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/inconshreveable/log15"
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/repository"
+	"github.com/spx/gitchain/server/config"
+	"github.com/spx/gitchain/server/context"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gitchain")
+	if err != nil {
+		t.Fatalf("error creating data directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	srv := &context.T{Config: config.Default()}
+	srv.Config.General.DataPath = dir
+	if err = srv.Init(); err != nil {
+		t.Fatalf("error initializing context: %v", err)
+	}
+	srv.Log.SetHandler(log15.DiscardHandler())
+	var requests int32
+	ch := srv.Router.Sub("/git/object/request")
+	go func() {
+		for msg := range ch {
+			atomic.AddInt32(&requests, 1)
+			msg.(*Request).ResponseChannel <- nil
+		}
+	}()
+
+	blob := func(content string) git.Hash {
+		b := &git.Blob{Content: []byte(content)}
+		if err := git.WriteObject(b, Dir(srv)); err != nil {
+			t.Fatalf("error writing object: %v", err)
+		}
+		return b.Hash()
+	}
+	// a tree stored locally whose commit is stored on other nodes
+	remoteTree := &git.Tree{}
+	remoteTree.SetBytes(append([]byte("100644 file\x00"), blob("remote")...))
+	git.WriteObject(remoteTree, Dir(srv))
+	remoteCommit := &git.Commit{}
+	remoteCommit.SetBytes([]byte(fmt.Sprintf("tree %s\n\nremote\n", git.Hash(remoteTree.Hash()))))
+
+	tree := &git.Tree{}
+	tree.SetBytes(append([]byte("100644 file\x00"), blob("local")...))
+	git.WriteObject(tree, Dir(srv))
+	commit := &git.Commit{}
+	commit.SetBytes([]byte(fmt.Sprintf("tree %s\nparent %s\n\nlocal\n", git.Hash(tree.Hash()), git.Hash(remoteCommit.Hash()))))
+	git.WriteObject(commit, Dir(srv))
+	garbage := blob("garbage")
+
+	updates := []repository.RefUpdate{{Ref: "refs/heads/master", Old: repository.EmptyRef(), New: repository.Ref(commit.Hash())}}
+	if _, err = srv.DB.UpdateRefs("repo", updates); err != nil {
+		t.Fatalf("error updating reference: %v", err)
+	}
+	srv.DB.PutRepository(repository.NewRepository("repo", repository.ACTIVE, nil))
+	for _, h := range []git.Hash{remoteTree.Hash(), remoteTree.Entries[0].Hash} {
+		assert.Nil(t, srv.DB.AddReachableObjects("repo", [][]byte{h}))
+	}
+
+	report, err := GC(srv, 0, false)
+	assert.Nil(t, err)
+	assert.Equal(t, report.Reachable, 5)
+	assert.Equal(t, report.Removed, 1)
+	assert.False(t, Exists(srv, garbage))
+	for _, h := range []git.Hash{commit.Hash(), tree.Hash(), tree.Entries[0].Hash, remoteTree.Hash(), remoteTree.Entries[0].Hash} {
+		assert.True(t, Exists(srv, h), h.String())
+	}
+	// missing objects aren't retrieved
+	assert.Equal(t, atomic.LoadInt32(&requests), int32(0))
+}
@@ -0,0 +1,72 @@
+package objects
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/server/context"
+)
+
+// Request asks the network for an object that isn't stored locally.
+// The object, or nil if nobody has it, is sent to ResponseChannel
+// (which should be buffered, late responses are dropped).
+type Request struct {
+	Hash            git.Hash
+	ResponseChannel chan git.Object
+}
+
+func Dir(srv *context.T) string {
+	return path.Join(srv.Config.General.DataPath, "objects")
+}
+
+// Exists tells whether an object is stored locally
+func Exists(srv *context.T, h git.Hash) bool {
+	return git.ObjectExists(h, Dir(srv))
+}
+
+// List returns the hashes of all objects stored locally
+func List(srv *context.T) ([]git.Hash, error) {
+	return git.ListObjects(Dir(srv))
+}
+
+// ReadLocal reads an object without resorting to the network
+func ReadLocal(srv *context.T, h git.Hash) (git.Object, error) {
+	return git.ReadObject(h, Dir(srv))
+}
+
+// Read reads an object, fetching it from the DHT if it isn't stored
+// locally. Fetched objects are kept in the local store.
+func Read(srv *context.T, h git.Hash) (git.Object, error) {
+	if obj, err := ReadLocal(srv, h); err == nil {
+		return obj, nil
+	}
+	obj, err := Fetch(srv, h)
+	if err != nil {
+		return nil, err
+	}
+	if err := git.WriteObject(obj, Dir(srv)); err != nil {
+		srv.Log.Error("error while caching object", "cmp", "objects", "obj", obj, "err", err)
+	}
+	return obj, nil
+}
+
+// Fetch retrieves an object from the DHT, without storing it locally
+func Fetch(srv *context.T, h git.Hash) (git.Object, error) {
+	response := make(chan git.Object, 1)
+	srv.Router.Pub(&Request{Hash: h, ResponseChannel: response}, "/git/object/request")
+	select {
+	case obj := <-response:
+		if obj == nil {
+			return nil, fmt.Errorf("object %s not found", h)
+		}
+		if bytes.Compare(obj.Hash(), h) != 0 {
+			return nil, fmt.Errorf("received %s instead of object %s", obj, h)
+		}
+		return obj, nil
+	case <-time.After(time.Duration(srv.Config.Network.ObjectTimeout) * time.Second):
+		return nil, fmt.Errorf("timed out while retrieving object %s", h)
+	}
+}
@@ -1,13 +1,129 @@
 package server
 
 import (
+	"bytes"
+	"fmt"
+
+	"github.com/inconshreveable/log15"
 	"github.com/spx/gitchain/block"
+	"github.com/spx/gitchain/git"
+	"github.com/spx/gitchain/keys"
+	"github.com/spx/gitchain/repository"
 	"github.com/spx/gitchain/server/context"
+	gitserver "github.com/spx/gitchain/server/git"
 	"github.com/spx/gitchain/transaction"
 )
 
 const REFUPDATE_CONFIRMATIONS_REQUIRED = 1
 
+// refUpdates returns the repository and the updates of a reference update
+// transaction, valid being false if they can't be applied
+func refUpdates(tx transaction.T) (reponame string, updates []repository.RefUpdate, valid bool) {
+	switch tx1 := tx.(type) {
+	case *transaction.ReferenceUpdate:
+		return tx1.Repository, []repository.RefUpdate{{Ref: tx1.Ref, Old: tx1.Old, New: tx1.New}}, tx1.Valid()
+	case *transaction.BatchReferenceUpdate:
+		return tx1.Repository, tx1.Updates, tx1.Valid()
+	}
+	return "", nil, false
+}
+
+// ownedRepository returns the repository a transaction changes the
+// settings of, or nil if it wasn't signed by the repository owner
+func ownedRepository(srv *context.T, name string, txe *transaction.Envelope, log log15.Logger) *repository.T {
+	owner, err := srv.DB.GetRepositoryOwner(name)
+	if err != nil {
+		log.Error("error while looking up repository owner", "txn", txe, "err", err)
+		return nil
+	}
+	// owner is in the current encoding, the transaction may be signed by
+	// a key published in another one
+	signer, err := keys.NormalizeECDSAPublicKey(txe.PublicKey)
+	if owner == nil || err != nil || bytes.Compare(owner, signer) != 0 {
+		log.Debug("ignoring repository change not made by the owner", "txn", txe)
+		return nil
+	}
+	repo, err := srv.DB.GetRepository(name)
+	if err != nil {
+		log.Error("error while retrieving repository", "txn", txe, "err", err)
+		return nil
+	}
+	return repo
+}
+
+// applyRefUpdates applies the reference updates of a confirmed transaction,
+// all of them or none, recording the outcome and announcing it on
+// /git/ref-update
+func applyRefUpdates(srv *context.T, txe *transaction.Envelope, reponame string, updates []repository.RefUpdate, log log15.Logger) {
+	status := repository.REF_UPDATE_APPLIED
+	for _, u := range updates {
+		if err := gitserver.CheckRefUpdate(srv, reponame, u.Ref, git.Hash(u.Old), git.Hash(u.New)); err != nil {
+			log.Info("rejected reference update", "txn", txe, "ref", u.Ref, "err", err)
+			status = fmt.Sprintf("%s %v", u.Ref, err)
+			break
+		}
+	}
+	if status == repository.REF_UPDATE_APPLIED {
+		updated, err := srv.DB.UpdateRefs(reponame, updates)
+		if err != nil {
+			log.Error("error while updating references", "txn", txe, "err", err)
+			return
+		}
+		if !updated {
+			log.Info("ignored stale reference update", "txn", txe)
+			status = "stale info"
+		} else {
+			refs := make([]string, len(updates))
+			for i := range updates {
+				refs[i] = updates[i].Ref
+			}
+			if err := srv.DB.PutRefTransaction(reponame, refs, txe.Hash()); err != nil {
+				log.Error("error while recording reference transaction", "txn", txe, "err", err)
+			}
+			logRefUpdates(srv, txe, reponame, updates, log)
+		}
+	}
+	if err := srv.DB.PutRefUpdateStatus(txe.Hash(), status); err != nil {
+		log.Error("error while recording reference update status", "txn", txe, "err", err)
+	}
+	srv.Router.Pub(txe.Hash(), "/git/ref-update")
+	if status != repository.REF_UPDATE_APPLIED {
+		gitserver.PostReceive(txe.Hash(), reponame, updates, false)
+		return
+	}
+	go func() {
+		// objects may have to be retrieved from the network
+		if err := gitserver.UpdateReachable(srv, reponame, updates); err != nil {
+			log.Error("error while indexing reachable objects", "txn", txe, "err", err)
+		}
+		gitserver.PostReceive(txe.Hash(), reponame, updates, true)
+	}()
+}
+
+// logRefUpdates appends applied reference updates to the logs of their
+// references
+func logRefUpdates(srv *context.T, txe *transaction.Envelope, reponame string, updates []repository.RefUpdate, log log15.Logger) {
+	blk, err := srv.DB.GetTransactionBlock(txe.Hash())
+	if err != nil {
+		log.Error("error while retrieving transaction block", "txn", txe, "err", err)
+		return
+	}
+	height, err := srv.DB.GetBlockHeight(blk.Hash())
+	if err != nil {
+		log.Error("error while computing block height", "txn", txe, "err", err)
+		return
+	}
+	entries := make([]*repository.RefLogEntry, len(updates))
+	for i, u := range updates {
+		entries[i] = &repository.RefLogEntry{Ref: u.Ref, Old: u.Old, New: u.New,
+			Transaction: txe.Hash(), Signer: txe.PublicKey,
+			Block: blk.Hash(), Height: height, Timestamp: blk.Timestamp}
+	}
+	if err := srv.DB.AddRefLogEntries(reponame, entries); err != nil {
+		log.Error("error while logging reference updates", "txn", txe, "err", err)
+	}
+}
+
 func RepositoryServer(srv *context.T) {
 	log := srv.Log.New("cmp", "repo")
 	ch := srv.Router.Sub("/block/last")
@@ -20,15 +136,53 @@ loop:
 				tx0 := blk.Transactions[i]
 				tx := tx0.Transaction
 				switch tx.(type) {
-				case *transaction.ReferenceUpdate:
-					tx1 := tx.(*transaction.ReferenceUpdate)
+				case *transaction.ReferenceUpdate, *transaction.BatchReferenceUpdate:
 					confirmations, err := srv.DB.GetTransactionConfirmations(tx0.Hash())
 					if err != nil {
 						log.Error("error during confirmation counting", "txn", tx0, "err", err)
 						goto loop
 					}
-					if confirmations >= REFUPDATE_CONFIRMATIONS_REQUIRED {
-						err = srv.DB.PutRef(tx1.Repository, tx1.Ref, tx1.New)
+					if confirmations < REFUPDATE_CONFIRMATIONS_REQUIRED {
+						break
+					}
+					reponame, updates, valid := refUpdates(tx)
+					if !valid {
+						log.Info("ignoring invalid reference update", "txn", tx0)
+						break
+					}
+					applyRefUpdates(srv, tx0, reponame, updates, log)
+				case *transaction.SigningKey:
+					tx1 := tx.(*transaction.SigningKey)
+					if err := srv.DB.PutSigningKey(tx0.PublicKey, tx1.Key); err != nil {
+						log.Error("error while recording signing key", "txn", tx0, "err", err)
+					}
+				case *transaction.DefaultBranch:
+					tx1 := tx.(*transaction.DefaultBranch)
+					if !tx1.Valid() {
+						log.Info("ignoring invalid default branch change", "txn", tx0)
+						break
+					}
+					repo := ownedRepository(srv, tx1.Repository, tx0, log)
+					if repo == nil {
+						break
+					}
+					repo.DefaultBranch = tx1.Branch
+					if err := srv.DB.PutRepository(repo); err != nil {
+						log.Error("error while changing default branch", "txn", tx0, "err", err)
+					}
+				case *transaction.BranchProtection:
+					tx1 := tx.(*transaction.BranchProtection)
+					if !tx1.Valid() {
+						log.Info("ignoring invalid branch protection change", "txn", tx0)
+						break
+					}
+					repo := ownedRepository(srv, tx1.Repository, tx0, log)
+					if repo == nil {
+						break
+					}
+					repo.SetProtected(tx1.Branch, tx1.Protected)
+					if err := srv.DB.PutRepository(repo); err != nil {
+						log.Error("error while changing branch protection", "txn", tx0, "err", err)
 					}
 				default:
 					// ignore all other transactions
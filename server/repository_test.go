@@ -0,0 +1,37 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/spx/gitchain/repository"
+	"github.com/spx/gitchain/transaction"
+	"github.com/spx/gitchain/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefUpdates(t *testing.T) {
+	update := repository.RefUpdate{Ref: "refs/heads/master", Old: repository.EmptyRef(), New: util.SHA160([]byte("random"))}
+	other := repository.RefUpdate{Ref: "refs/tags/v1", Old: repository.EmptyRef(), New: util.SHA160([]byte("not random"))}
+
+	for _, c := range []struct {
+		name    string
+		tx      transaction.T
+		updates []repository.RefUpdate
+		valid   bool
+	}{
+		{"reference update", transaction.NewReferenceUpdate("repo", update.Ref, update.Old, update.New), []repository.RefUpdate{update}, true},
+		{"reference update without ref", transaction.NewReferenceUpdate("repo", "", update.Old, update.New), nil, false},
+		{"batch", transaction.NewBatchReferenceUpdate("repo", []repository.RefUpdate{update, other}), []repository.RefUpdate{update, other}, true},
+		{"empty batch", transaction.NewBatchReferenceUpdate("repo", nil), nil, false},
+		{"batch with a duplicated ref", transaction.NewBatchReferenceUpdate("repo", []repository.RefUpdate{update, update}), nil, false},
+		{"batch without repository", transaction.NewBatchReferenceUpdate("", []repository.RefUpdate{update}), nil, false},
+		{"other transaction", transaction.NewBranchProtection("repo", "master", true), nil, false},
+	} {
+		reponame, updates, valid := refUpdates(c.tx)
+		assert.Equal(t, valid, c.valid, c.name)
+		if c.valid {
+			assert.Equal(t, reponame, "repo", c.name)
+			assert.Equal(t, updates, c.updates, c.name)
+		}
+	}
+}
@@ -2,14 +2,14 @@
 package transaction
 
 import (
-	"encoding/gob"
 	"encoding/json"
 
 	"github.com/spx/gitchain/types"
+	"github.com/spx/gitchain/wire"
 )
 
 func init() {
-	gob.Register(&BlockAttribution{})
+	register(BLOCK_ATTRIBUTION_TAG, func() T { return &BlockAttribution{} })
 }
 
 //// Block Allocation Transaction (BAT)
@@ -39,7 +39,15 @@ func (txn *BlockAttribution) Valid() bool {
 }
 
 func (txn *BlockAttribution) Encode() ([]byte, error) {
-	return encode(txn)
+	return encode(BLOCK_ATTRIBUTION_TAG, txn)
+}
+
+func (txn *BlockAttribution) encodeFields(enc *wire.Encoder) {
+	enc.PutUint32(txn.Version)
+}
+
+func (txn *BlockAttribution) decodeFields(dec *wire.Decoder) {
+	txn.Version = dec.Uint32()
 }
 
 func (txn *BlockAttribution) Hash() types.Hash {
@@ -0,0 +1,82 @@
+// Branch Protection Transaction (BPT)
+package transaction
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spx/gitchain/types"
+	"github.com/spx/gitchain/wire"
+)
+
+func init() {
+	register(BRANCH_PROTECTION_TAG, func() T { return &BranchProtection{} })
+}
+
+const (
+	BRANCH_PROTECTION_VERSION = 1
+)
+
+// BranchProtection protects a branch of a repository against deletion
+// and non-fast-forward updates, or lifts that protection. It is only
+// honoured when signed by the repository owner. Deletion is refused when
+// updates are applied, non-fast-forward updates only by the node a push
+// is received by.
+type BranchProtection struct {
+	Version    uint32
+	Repository string
+	Branch     string // without the refs/heads/ prefix
+	Protected  bool
+}
+
+func (tx *BranchProtection) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"Type":       "Branch Protection Transaction",
+		"Version":    tx.Version,
+		"Repository": tx.Repository,
+		"Branch":     tx.Branch,
+		"Protected":  tx.Protected,
+	})
+}
+
+func NewBranchProtection(repository, branch string, protected bool) *BranchProtection {
+	return &BranchProtection{
+		Version:    BRANCH_PROTECTION_VERSION,
+		Repository: repository,
+		Branch:     branch,
+		Protected:  protected}
+}
+
+func (txn *BranchProtection) Valid() bool {
+	return (txn.Version == BRANCH_PROTECTION_VERSION && len(txn.Repository) > 0 &&
+		validBranchName(txn.Branch))
+}
+
+func (txn *BranchProtection) Encode() ([]byte, error) {
+	return encode(BRANCH_PROTECTION_TAG, txn)
+}
+
+func (txn *BranchProtection) encodeFields(enc *wire.Encoder) {
+	enc.PutUint32(txn.Version)
+	enc.PutString(txn.Repository)
+	enc.PutString(txn.Branch)
+	enc.PutBool(txn.Protected)
+}
+
+func (txn *BranchProtection) decodeFields(dec *wire.Decoder) {
+	txn.Version = dec.Uint32()
+	txn.Repository = dec.String()
+	txn.Branch = dec.String()
+	txn.Protected = dec.Bool()
+}
+
+func (txn *BranchProtection) Hash() types.Hash {
+	return hash(txn)
+}
+
+func (txn *BranchProtection) String() string {
+	if txn.Protected {
+		return fmt.Sprintf("BPT %s %s protected", txn.Repository, txn.Branch)
+	}
+	return fmt.Sprintf("BPT %s %s unprotected", txn.Repository, txn.Branch)
+}
@@ -0,0 +1,28 @@
+package transaction
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBranchProtection(t *testing.T) {
+	txn := NewBranchProtection("my-new-repo", "master", true)
+
+	assert.True(t, txn.Valid())
+	txn2 := *txn
+	txn2.Version = 100
+	assert.False(t, txn2.Valid())
+	txn2 = *txn
+	txn2.Repository = ""
+	assert.False(t, txn2.Valid())
+	txn2 = *txn
+	txn2.Branch = "refs/heads/master"
+	assert.False(t, txn2.Valid())
+}
+
+func TestBranchProtectionEncodingDecoding(t *testing.T) {
+	txn := NewBranchProtection("my-new-repo", "master", true)
+
+	testTransactionEncodingDecoding(t, txn)
+}
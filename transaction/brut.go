@@ -0,0 +1,103 @@
+// Batch Reference Update Transaction (BRUT)
+package transaction
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spx/gitchain/repository"
+	"github.com/spx/gitchain/types"
+	"github.com/spx/gitchain/wire"
+)
+
+func init() {
+	register(BATCH_REFERENCE_UPDATE_TAG, func() T { return &BatchReferenceUpdate{} })
+}
+
+const (
+	BATCH_REFERENCE_UPDATE_VERSION = 1
+)
+
+// BatchReferenceUpdate updates several references of a repository at once,
+// none of them being updated if any of the updates can't be applied
+type BatchReferenceUpdate struct {
+	Version    uint32
+	Repository string
+	Updates    []repository.RefUpdate
+}
+
+func (tx *BatchReferenceUpdate) MarshalJSON() ([]byte, error) {
+	updates := make([]map[string]interface{}, len(tx.Updates))
+	for i := range tx.Updates {
+		updates[i] = map[string]interface{}{
+			"Ref": tx.Updates[i].Ref,
+			"Old": hex.EncodeToString(tx.Updates[i].Old),
+			"New": hex.EncodeToString(tx.Updates[i].New),
+		}
+	}
+	return json.Marshal(map[string]interface{}{
+		"Type":       "Batch Reference Update Transaction",
+		"Version":    tx.Version,
+		"Repository": tx.Repository,
+		"Updates":    updates,
+	})
+}
+
+func NewBatchReferenceUpdate(repository string, updates []repository.RefUpdate) *BatchReferenceUpdate {
+	return &BatchReferenceUpdate{
+		Version:    BATCH_REFERENCE_UPDATE_VERSION,
+		Repository: repository,
+		Updates:    updates}
+}
+
+func (txn *BatchReferenceUpdate) Valid() bool {
+	if txn.Version != BATCH_REFERENCE_UPDATE_VERSION || len(txn.Repository) == 0 || len(txn.Updates) == 0 {
+		return false
+	}
+	refs := make(map[string]bool)
+	for i := range txn.Updates {
+		if len(txn.Updates[i].Ref) == 0 || refs[txn.Updates[i].Ref] {
+			return false
+		}
+		refs[txn.Updates[i].Ref] = true
+	}
+	return true
+}
+
+func (txn *BatchReferenceUpdate) Encode() ([]byte, error) {
+	return encode(BATCH_REFERENCE_UPDATE_TAG, txn)
+}
+
+func (txn *BatchReferenceUpdate) encodeFields(enc *wire.Encoder) {
+	enc.PutUint32(txn.Version)
+	enc.PutString(txn.Repository)
+	enc.PutCount(len(txn.Updates))
+	for i := range txn.Updates {
+		enc.PutString(txn.Updates[i].Ref)
+		enc.PutBytes(txn.Updates[i].Old)
+		enc.PutBytes(txn.Updates[i].New)
+	}
+}
+
+func (txn *BatchReferenceUpdate) decodeFields(dec *wire.Decoder) {
+	txn.Version = dec.Uint32()
+	txn.Repository = dec.String()
+	n := dec.Count()
+	for i := 0; i < n; i++ {
+		txn.Updates = append(txn.Updates, repository.RefUpdate{Ref: dec.String(), Old: dec.Bytes(), New: dec.Bytes()})
+	}
+}
+
+func (txn *BatchReferenceUpdate) Hash() types.Hash {
+	return hash(txn)
+}
+
+func (txn *BatchReferenceUpdate) String() string {
+	updates := make([]string, len(txn.Updates))
+	for i := range txn.Updates {
+		updates[i] = fmt.Sprintf("%s %s:%s", txn.Updates[i].Ref, txn.Updates[i].Old, txn.Updates[i].New)
+	}
+	return fmt.Sprintf("BRUT %s %s", txn.Repository, strings.Join(updates, " "))
+}
@@ -0,0 +1,42 @@
+package transaction
+
+import (
+	"testing"
+
+	"github.com/spx/gitchain/repository"
+	"github.com/spx/gitchain/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func fixtureBatchReferenceUpdate() *BatchReferenceUpdate {
+	return NewBatchReferenceUpdate("my-repository", []repository.RefUpdate{
+		{Ref: "refs/heads/master", Old: util.SHA160([]byte("random")), New: util.SHA160([]byte("not random"))},
+		{Ref: "refs/tags/v1", Old: repository.EmptyRef(), New: util.SHA160([]byte("random"))},
+	})
+}
+
+func TestBatchReferenceUpdate(t *testing.T) {
+	txn := fixtureBatchReferenceUpdate()
+
+	assert.True(t, txn.Valid())
+	txn2 := *txn
+	txn2.Version = 100
+	assert.False(t, txn2.Valid())
+	txn2 = *txn
+	txn2.Repository = ""
+	assert.False(t, txn2.Valid())
+	txn2 = *txn
+	txn2.Updates = nil
+	assert.False(t, txn2.Valid())
+	txn2 = *txn
+	txn2.Updates = []repository.RefUpdate{txn.Updates[0], {Ref: ""}}
+	assert.False(t, txn2.Valid())
+	txn2.Updates = []repository.RefUpdate{txn.Updates[0], txn.Updates[0]}
+	assert.False(t, txn2.Valid())
+}
+
+func TestBatchReferenceUpdateEncodingDecoding(t *testing.T) {
+	txn := fixtureBatchReferenceUpdate()
+
+	testTransactionEncodingDecoding(t, txn)
+}
@@ -0,0 +1,86 @@
+// Default Branch Transaction (DBT)
+package transaction
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spx/gitchain/types"
+	"github.com/spx/gitchain/wire"
+)
+
+func init() {
+	register(DEFAULT_BRANCH_TAG, func() T { return &DefaultBranch{} })
+}
+
+const (
+	DEFAULT_BRANCH_VERSION = 1
+)
+
+// DefaultBranch changes the branch a repository's HEAD points to. It is
+// only honoured when signed by the repository owner.
+type DefaultBranch struct {
+	Version    uint32
+	Repository string
+	Branch     string // without the refs/heads/ prefix
+}
+
+func (tx *DefaultBranch) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"Type":       "Default Branch Transaction",
+		"Version":    tx.Version,
+		"Repository": tx.Repository,
+		"Branch":     tx.Branch,
+	})
+}
+
+func NewDefaultBranch(repository, branch string) *DefaultBranch {
+	return &DefaultBranch{
+		Version:    DEFAULT_BRANCH_VERSION,
+		Repository: repository,
+		Branch:     branch}
+}
+
+func validBranchName(name string) bool {
+	if len(name) == 0 || strings.HasPrefix(name, "refs/") || strings.HasPrefix(name, "-") ||
+		strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".lock") ||
+		strings.Contains(name, "..") || strings.Contains(name, "//") || strings.Contains(name, "@{") {
+		return false
+	}
+	for _, c := range name {
+		if c <= ' ' || c == 0x7f || strings.ContainsRune("~^:?*[\\", c) {
+			return false
+		}
+	}
+	return true
+}
+
+func (txn *DefaultBranch) Valid() bool {
+	return (txn.Version == DEFAULT_BRANCH_VERSION && len(txn.Repository) > 0 &&
+		validBranchName(txn.Branch))
+}
+
+func (txn *DefaultBranch) Encode() ([]byte, error) {
+	return encode(DEFAULT_BRANCH_TAG, txn)
+}
+
+func (txn *DefaultBranch) encodeFields(enc *wire.Encoder) {
+	enc.PutUint32(txn.Version)
+	enc.PutString(txn.Repository)
+	enc.PutString(txn.Branch)
+}
+
+func (txn *DefaultBranch) decodeFields(dec *wire.Decoder) {
+	txn.Version = dec.Uint32()
+	txn.Repository = dec.String()
+	txn.Branch = dec.String()
+}
+
+func (txn *DefaultBranch) Hash() types.Hash {
+	return hash(txn)
+}
+
+func (txn *DefaultBranch) String() string {
+	return fmt.Sprintf("DBT %s %s", txn.Repository, txn.Branch)
+}
@@ -0,0 +1,32 @@
+package transaction
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultBranch(t *testing.T) {
+	txn := NewDefaultBranch("my-new-repo", "main")
+
+	assert.True(t, txn.Valid())
+	txn2 := *txn
+	txn2.Version = 100
+	assert.False(t, txn2.Valid())
+	txn2 = *txn
+	txn2.Repository = ""
+	assert.False(t, txn2.Valid())
+	for _, branch := range []string{"", "refs/heads/main", "a b", "a..b", "a:b", "main.lock", "-main", "main/", "a\nb"} {
+		txn2 = *txn
+		txn2.Branch = branch
+		assert.False(t, txn2.Valid(), branch)
+	}
+	txn2.Branch = "release/1.0"
+	assert.True(t, txn2.Valid())
+}
+
+func TestDefaultBranchEncodingDecoding(t *testing.T) {
+	txn := NewDefaultBranch("my-new-repo", "main")
+
+	testTransactionEncodingDecoding(t, txn)
+}
@@ -4,13 +4,14 @@ import (
 	"bytes"
 	"crypto/ecdsa"
 	"crypto/rand"
-	"encoding/gob"
+	"errors"
 	"fmt"
 	"math/big"
 
 	"github.com/spx/gitchain/keys"
 	"github.com/spx/gitchain/types"
 	"github.com/spx/gitchain/util"
+	"github.com/spx/gitchain/wire"
 )
 
 type Envelope struct {
@@ -70,19 +71,48 @@ func (e *Envelope) Verify() (bool, error) {
 	return ecdsa.Verify(publicKey, e.Hash(), r, s), nil
 }
 
+// ENVELOPE_VERSION is the version of the encoding of envelopes
+const ENVELOPE_VERSION = 1
+
 func (e *Envelope) Encode() ([]byte, error) {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	err := enc.Encode(&e)
-	return buf.Bytes(), err
+	if e.Transaction == nil {
+		return nil, errors.New("envelope has no transaction")
+	}
+	txn, err := e.Transaction.Encode()
+	if err != nil {
+		return nil, err
+	}
+	enc := wire.NewEncoder()
+	enc.PutUint8(ENVELOPE_VERSION)
+	enc.PutBytes(e.PreviousEnvelopeHash)
+	enc.PutBytes(e.SignatureR)
+	enc.PutBytes(e.SignatureS)
+	enc.PutBytes(e.PublicKey)
+	enc.PutBytes(e.NextPublicKey)
+	enc.PutBytes(txn)
+	return enc.Bytes(), nil
 }
 
 func DecodeEnvelope(b []byte) (*Envelope, error) {
-	var t *Envelope
-	buf := bytes.NewBuffer(b)
-	enc := gob.NewDecoder(buf)
-	err := enc.Decode(&t)
-	return t, err
+	dec := wire.NewDecoder(b)
+	if version := dec.Uint8(); dec.Err() == nil && version != ENVELOPE_VERSION {
+		return nil, fmt.Errorf("unsupported envelope version %d", version)
+	}
+	e := &Envelope{
+		PreviousEnvelopeHash: dec.Bytes(),
+		SignatureR:           dec.Bytes(),
+		SignatureS:           dec.Bytes(),
+		PublicKey:            dec.Bytes(),
+		NextPublicKey:        dec.Bytes()}
+	txn := dec.Bytes()
+	if err := dec.Finish(); err != nil {
+		return nil, err
+	}
+	var err error
+	if e.Transaction, err = Decode(txn); err != nil {
+		return nil, err
+	}
+	return e, nil
 }
 
 func (e *Envelope) String() string {
@@ -51,3 +51,27 @@ func TestEnvelopeEncodeDecode(t *testing.T) {
 
 	assert.Equal(t, e, e1)
 }
+
+func TestEnvelopeVerifyUncompressedPublicKey(t *testing.T) {
+	privateKey := generateKey(t)
+	txn, _ := NewNameReservation("my-new-repository")
+
+	e := NewEnvelope(types.EmptyHash(), txn)
+
+	err := e.Sign(privateKey)
+	if err != nil {
+		t.Errorf("Can't sign the envelope: %v", err)
+	}
+	assert.Equal(t, len(e.PublicKey), 33)
+
+	// envelopes published before public keys were compressed
+	x, y := privateKey.PublicKey.X.Bytes(), privateKey.PublicKey.Y.Bytes()
+	e.PublicKey = make([]byte, 65)
+	e.PublicKey[0] = 0x04
+	copy(e.PublicKey[33-len(x):33], x)
+	copy(e.PublicKey[65-len(y):], y)
+
+	v, err := e.Verify()
+	assert.Nil(t, err)
+	assert.True(t, v)
+}
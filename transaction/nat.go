@@ -2,16 +2,16 @@
 package transaction
 
 import (
-	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 
 	"github.com/spx/gitchain/types"
+	"github.com/spx/gitchain/wire"
 )
 
 func init() {
-	gob.Register(&NameAllocation{})
+	register(NAME_ALLOCATION_TAG, func() T { return &NameAllocation{} })
 }
 
 const (
@@ -46,7 +46,19 @@ func (txn *NameAllocation) Valid() bool {
 }
 
 func (txn *NameAllocation) Encode() ([]byte, error) {
-	return encode(txn)
+	return encode(NAME_ALLOCATION_TAG, txn)
+}
+
+func (txn *NameAllocation) encodeFields(enc *wire.Encoder) {
+	enc.PutUint32(txn.Version)
+	enc.PutString(txn.Name)
+	enc.PutBytes(txn.Rand)
+}
+
+func (txn *NameAllocation) decodeFields(dec *wire.Decoder) {
+	txn.Version = dec.Uint32()
+	txn.Name = dec.String()
+	txn.Rand = dec.Bytes()
 }
 
 func (txn *NameAllocation) Hash() types.Hash {
@@ -2,15 +2,15 @@
 package transaction
 
 import (
-	"encoding/gob"
 	"encoding/json"
 	"fmt"
 
 	"github.com/spx/gitchain/types"
+	"github.com/spx/gitchain/wire"
 )
 
 func init() {
-	gob.Register(&NameDeallocation{})
+	register(NAME_DEALLOCATION_TAG, func() T { return &NameDeallocation{} })
 }
 
 const (
@@ -41,7 +41,17 @@ func (txn *NameDeallocation) Valid() bool {
 }
 
 func (txn *NameDeallocation) Encode() ([]byte, error) {
-	return encode(txn)
+	return encode(NAME_DEALLOCATION_TAG, txn)
+}
+
+func (txn *NameDeallocation) encodeFields(enc *wire.Encoder) {
+	enc.PutUint32(txn.Version)
+	enc.PutString(txn.Name)
+}
+
+func (txn *NameDeallocation) decodeFields(dec *wire.Decoder) {
+	txn.Version = dec.Uint32()
+	txn.Name = dec.String()
 }
 
 func (txn *NameDeallocation) Hash() types.Hash {
@@ -3,17 +3,17 @@ package transaction
 
 import (
 	"crypto/rand"
-	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 
 	"github.com/spx/gitchain/types"
 	"github.com/spx/gitchain/util"
+	"github.com/spx/gitchain/wire"
 )
 
 func init() {
-	gob.Register(&NameReservation{})
+	register(NAME_RESERVATION_TAG, func() T { return &NameReservation{} })
 }
 
 const (
@@ -46,7 +46,17 @@ func (txn *NameReservation) Valid() bool {
 }
 
 func (txn *NameReservation) Encode() ([]byte, error) {
-	return encode(txn)
+	return encode(NAME_RESERVATION_TAG, txn)
+}
+
+func (txn *NameReservation) encodeFields(enc *wire.Encoder) {
+	enc.PutUint32(txn.Version)
+	enc.PutBytes(txn.Hashed)
+}
+
+func (txn *NameReservation) decodeFields(dec *wire.Decoder) {
+	txn.Version = dec.Uint32()
+	txn.Hashed = dec.Bytes()
 }
 
 func (txn *NameReservation) Hash() types.Hash {
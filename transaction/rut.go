@@ -2,17 +2,17 @@
 package transaction
 
 import (
-	"encoding/gob"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 
 	"github.com/spx/gitchain/repository"
 	"github.com/spx/gitchain/types"
+	"github.com/spx/gitchain/wire"
 )
 
 func init() {
-	gob.Register(&ReferenceUpdate{})
+	register(REFERENCE_UPDATE_TAG, func() T { return &ReferenceUpdate{} })
 }
 
 const (
@@ -53,7 +53,23 @@ func (txn *ReferenceUpdate) Valid() bool {
 }
 
 func (txn *ReferenceUpdate) Encode() ([]byte, error) {
-	return encode(txn)
+	return encode(REFERENCE_UPDATE_TAG, txn)
+}
+
+func (txn *ReferenceUpdate) encodeFields(enc *wire.Encoder) {
+	enc.PutUint32(txn.Version)
+	enc.PutString(txn.Repository)
+	enc.PutString(txn.Ref)
+	enc.PutBytes(txn.Old)
+	enc.PutBytes(txn.New)
+}
+
+func (txn *ReferenceUpdate) decodeFields(dec *wire.Decoder) {
+	txn.Version = dec.Uint32()
+	txn.Repository = dec.String()
+	txn.Ref = dec.String()
+	txn.Old = dec.Bytes()
+	txn.New = dec.Bytes()
 }
 
 func (txn *ReferenceUpdate) Hash() types.Hash {
@@ -0,0 +1,66 @@
+// Signing Key Transaction (SKT)
+package transaction
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spx/gitchain/types"
+	"github.com/spx/gitchain/util"
+	"github.com/spx/gitchain/wire"
+)
+
+func init() {
+	register(SIGNING_KEY_TAG, func() T { return &SigningKey{} })
+}
+
+const (
+	SIGNING_KEY_VERSION = 1
+)
+
+// SigningKey publishes an armored OpenPGP public key used to sign
+// commits and tags, on behalf of the envelope's key holder
+type SigningKey struct {
+	Version uint32
+	Key     []byte
+}
+
+func (tx *SigningKey) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"Type":    "Signing Key Transaction",
+		"Version": tx.Version,
+		"Key":     string(tx.Key),
+	})
+}
+
+func NewSigningKey(key []byte) *SigningKey {
+	return &SigningKey{
+		Version: SIGNING_KEY_VERSION,
+		Key:     key}
+}
+
+func (txn *SigningKey) Valid() bool {
+	return (txn.Version == SIGNING_KEY_VERSION && len(txn.Key) > 0)
+}
+
+func (txn *SigningKey) Encode() ([]byte, error) {
+	return encode(SIGNING_KEY_TAG, txn)
+}
+
+func (txn *SigningKey) encodeFields(enc *wire.Encoder) {
+	enc.PutUint32(txn.Version)
+	enc.PutBytes(txn.Key)
+}
+
+func (txn *SigningKey) decodeFields(dec *wire.Decoder) {
+	txn.Version = dec.Uint32()
+	txn.Key = dec.Bytes()
+}
+
+func (txn *SigningKey) Hash() types.Hash {
+	return hash(txn)
+}
+
+func (txn *SigningKey) String() string {
+	return fmt.Sprintf("SKT %s", types.Hash(util.SHA256(txn.Key)))
+}
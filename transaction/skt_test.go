@@ -0,0 +1,25 @@
+package transaction
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSigningKey(t *testing.T) {
+	txn := NewSigningKey([]byte("-----BEGIN PGP PUBLIC KEY BLOCK-----"))
+
+	assert.True(t, txn.Valid())
+	txn2 := *txn
+	txn2.Version = 100
+	assert.False(t, txn2.Valid())
+	txn2 = *txn
+	txn2.Key = nil
+	assert.False(t, txn2.Valid())
+}
+
+func TestSigningKeyEncodingDecoding(t *testing.T) {
+	txn := NewSigningKey([]byte("-----BEGIN PGP PUBLIC KEY BLOCK-----"))
+
+	testTransactionEncodingDecoding(t, txn)
+}
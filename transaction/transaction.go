@@ -1,12 +1,11 @@
 package transaction
 
 import (
-	"bytes"
-	"encoding/binary"
-	"encoding/gob"
+	"fmt"
 
-	"github.com/conformal/fastsha256"
 	"github.com/spx/gitchain/types"
+	"github.com/spx/gitchain/util"
+	"github.com/spx/gitchain/wire"
 )
 
 //// Interface
@@ -15,28 +14,60 @@ type T interface {
 	Encode() ([]byte, error)
 	Hash() types.Hash
 	Valid() bool
+	// encodeFields and decodeFields (de)serialize the fields of a
+	// transaction, starting with its version
+	encodeFields(*wire.Encoder)
+	decodeFields(*wire.Decoder)
+}
+
+// Tags identifying the type of a transaction in its encoding. They are
+// part of the transactions' hashes and must never be changed or reused.
+const (
+	BLOCK_ATTRIBUTION_TAG uint8 = iota + 1
+	NAME_RESERVATION_TAG
+	NAME_ALLOCATION_TAG
+	NAME_DEALLOCATION_TAG
+	REFERENCE_UPDATE_TAG
+	SIGNING_KEY_TAG
+	DEFAULT_BRANCH_TAG
+	BRANCH_PROTECTION_TAG
+	BATCH_REFERENCE_UPDATE_TAG
+)
+
+var transactionTypes = make(map[uint8]func() T)
+
+// register makes a type of transaction decodable
+func register(tag uint8, new func() T) {
+	transactionTypes[tag] = new
 }
 
 func hash(t T) []byte {
-	buf := new(bytes.Buffer)
-	gob.NewEncoder(buf).Encode(t)
-	encoded := buf.Bytes()
-	buf.Reset()
-	binary.Write(buf, binary.BigEndian, fastsha256.Sum256(encoded))
-	return buf.Bytes()
+	encoded, _ := t.Encode()
+	return util.SHA256(encoded)
 }
 
-func encode(t T) ([]byte, error) {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	err := enc.Encode(&t)
-	return buf.Bytes(), err
+// encode serializes a transaction as its type tag followed by its fields
+func encode(tag uint8, t T) ([]byte, error) {
+	enc := wire.NewEncoder()
+	enc.PutUint8(tag)
+	t.encodeFields(enc)
+	return enc.Bytes(), nil
 }
 
 func Decode(b []byte) (T, error) {
-	var t T
-	buf := bytes.NewBuffer(b)
-	enc := gob.NewDecoder(buf)
-	err := enc.Decode(&t)
-	return t, err
+	dec := wire.NewDecoder(b)
+	tag := dec.Uint8()
+	if err := dec.Err(); err != nil {
+		return nil, err
+	}
+	new, ok := transactionTypes[tag]
+	if !ok {
+		return nil, fmt.Errorf("unknown transaction type %d", tag)
+	}
+	t := new()
+	t.decodeFields(dec)
+	if err := dec.Finish(); err != nil {
+		return nil, err
+	}
+	return t, nil
 }
@@ -2,9 +2,13 @@ package transaction
 
 import (
 	"crypto/ecdsa"
+	"encoding/hex"
 	"testing"
 
 	"github.com/spx/gitchain/keys"
+	"github.com/spx/gitchain/repository"
+	"github.com/spx/gitchain/types"
+	"github.com/spx/gitchain/util"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,6 +25,87 @@ func testTransactionEncodingDecoding(t *testing.T, txn T) {
 	assert.Equal(t, txn1, txn, "encoded and decoded transaction should be identical to the original one")
 }
 
+// the encodings and hashes of transactions are part of the consensus
+// rules, these vectors must never change
+var goldenTransactions = []struct {
+	txn      T
+	encoding string
+	hash     string
+}{
+	{&BlockAttribution{Version: 1},
+		"0100000001",
+		"a1cb20470d89874f33383802c72d3c27a0668ebffd81934705ab0cfcbf1a1e3a"},
+	{&NameReservation{Version: 1, Hashed: util.SHA256([]byte("name"))},
+		"02000000010000002082a3537ff0dbce7eec35d69edc3a189ee6f17d82f353a553f9aa96cb0be3ce89",
+		"c6c6ca1028b1455a75f1b5825b30a8198482cc97d5282031756290b2a09ec3cf"},
+	{&NameAllocation{Version: 1, Name: "repo", Rand: []byte{1, 2, 3, 4}},
+		"0300000001000000047265706f0000000401020304",
+		"93016e07046ae34327f79286d1a41662c4a433c2132d4e1f3f27e43c80ddefdc"},
+	{&NameDeallocation{Version: 1, Name: "repo"},
+		"0400000001000000047265706f",
+		"6ca4aa0b2f1f9fad0eba59124037e95bd7fa1620885cfc87f3f8ef2d5643fbe2"},
+	{&ReferenceUpdate{Version: 1, Repository: "repo", Ref: "refs/heads/master", Old: util.SHA160([]byte("old")), New: util.SHA160([]byte("new"))},
+		"0500000001000000047265706f00000011726566732f68656164732f6d617374657200000014c00dbbc9dadfbe1e232e93a729dd4752fade0abf00000014c2a6b03f190dfb2b4aa91f8af8d477a9bc3401dc",
+		"c488985d67950def42fd5be9c704ad06ef57eb27d9ecaed094e295e4a3d18ca2"},
+	{&SigningKey{Version: 1, Key: []byte("key")},
+		"0600000001000000036b6579",
+		"31de85d170e69b4556650b646e13c35b02c7121b343a99fd82f3e5091128ed28"},
+	{&DefaultBranch{Version: 1, Repository: "repo", Branch: "main"},
+		"0700000001000000047265706f000000046d61696e",
+		"5888364129474177a0b8ea7ef6eaaac467ee29a5a171a490fdf6aed93769c561"},
+	{&BranchProtection{Version: 1, Repository: "repo", Branch: "main", Protected: true},
+		"0800000001000000047265706f000000046d61696e01",
+		"4a4e1ee79b6fd28ccd64b2ced2affedb333f8acf8915bcd8abe92cc5bb097070"},
+	{&BatchReferenceUpdate{Version: 1, Repository: "repo", Updates: []repository.RefUpdate{
+		{Ref: "refs/heads/a", Old: util.SHA160([]byte("old")), New: util.SHA160([]byte("new"))},
+		{Ref: "refs/tags/b", Old: repository.EmptyRef(), New: util.SHA160([]byte("new"))}}},
+		"0900000001000000047265706f000000020000000c726566732f68656164732f6100000014c00dbbc9dadfbe1e232e93a729dd4752fade0abf00000014c2a6b03f190dfb2b4aa91f8af8d477a9bc3401dc0000000b726566732f746167732f6200000014000000000000000000000000000000000000000000000014c2a6b03f190dfb2b4aa91f8af8d477a9bc3401dc",
+		"21f6ea481eb6cf5808679bfb6dee84aa624ed812799afd25a39565977f80e7cf"},
+}
+
+func TestTransactionGoldenVectors(t *testing.T) {
+	for _, g := range goldenTransactions {
+		enc, err := g.txn.Encode()
+		assert.Nil(t, err)
+		assert.Equal(t, hex.EncodeToString(enc), g.encoding, "encoding of %T", g.txn)
+		assert.Equal(t, hex.EncodeToString(g.txn.Hash()), g.hash, "hash of %T", g.txn)
+		testTransactionEncodingDecoding(t, g.txn)
+	}
+}
+
+func TestDecodeRejectsNonCanonicalEncodings(t *testing.T) {
+	enc, _ := hex.DecodeString(goldenTransactions[0].encoding)
+	_, err := Decode(append(enc, 0))
+	assert.NotNil(t, err, "trailing bytes")
+	_, err = Decode(enc[0 : len(enc)-1])
+	assert.NotNil(t, err, "truncated encoding")
+	_, err = Decode(append([]byte{0xff}, enc[1:]...))
+	assert.NotNil(t, err, "unknown type")
+	// BPT with a boolean other than 0 or 1
+	enc, _ = hex.DecodeString(goldenTransactions[7].encoding)
+	enc[len(enc)-1] = 2
+	_, err = Decode(enc)
+	assert.NotNil(t, err, "invalid boolean")
+}
+
+func TestEnvelopeGoldenVector(t *testing.T) {
+	pub, _ := hex.DecodeString("0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")
+	e := &Envelope{
+		PreviousEnvelopeHash: types.EmptyHash(),
+		SignatureR:           []byte{1},
+		SignatureS:           []byte{2},
+		PublicKey:            pub,
+		NextPublicKey:        pub,
+		Transaction:          goldenTransactions[4].txn}
+	enc, err := e.Encode()
+	assert.Nil(t, err)
+	assert.Equal(t, hex.EncodeToString(enc), "0100000020000000000000000000000000000000000000000000000000000000000000000000000001010000000102000000410479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8000000410479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8000000520500000001000000047265706f00000011726566732f68656164732f6d617374657200000014c00dbbc9dadfbe1e232e93a729dd4752fade0abf00000014c2a6b03f190dfb2b4aa91f8af8d477a9bc3401dc")
+	assert.Equal(t, hex.EncodeToString(e.Hash()), "457dd0181c963168a83cff695cc4a948a635e8a3563685cf3034943d881e1e83")
+	e1, err := DecodeEnvelope(enc)
+	assert.Nil(t, err)
+	assert.Equal(t, e1, e)
+}
+
 func generateKey(t *testing.T) *ecdsa.PrivateKey {
 	privateKey, err := keys.GenerateECDSA()
 	if err != nil {
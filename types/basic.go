@@ -16,5 +16,5 @@ func (h Hash) String() string {
 }
 
 func (h Hash) Equals(h1 Hash) bool {
-	return bytes.Compare(h, h) == 0
+	return bytes.Compare(h, h1) == 0
 }
@@ -0,0 +1,28 @@
+package types
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashEquals(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		h, h1  Hash
+		equals bool
+	}{
+		{"same hash", Hash{1, 2, 3}, Hash{1, 2, 3}, true},
+		{"different hashes", Hash{1, 2, 3}, Hash{1, 2, 4}, false},
+		{"prefix", Hash{1, 2, 3}, Hash{1, 2}, false},
+		{"empty hashes", EmptyHash(), EmptyHash(), true},
+		{"empty hash and another one", EmptyHash(), Hash{1, 2, 3}, false},
+		{"empty hash and nil", EmptyHash(), nil, false},
+		{"nil and a hash", nil, Hash{1, 2, 3}, false},
+		{"nils", nil, nil, true},
+		{"nil and zero length hash", nil, Hash{}, true},
+	} {
+		assert.Equal(t, c.h.Equals(c.h1), c.equals, c.name)
+		assert.Equal(t, c.h1.Equals(c.h), c.equals, c.name)
+	}
+}
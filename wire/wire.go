@@ -0,0 +1,187 @@
+// Package wire implements the canonical binary encoding of the types
+// blocks and transactions are made of.
+//
+// Values are written one after the other, without names or type
+// information:
+//
+//	unsigned and signed integers  fixed size, big-endian
+//	booleans                      a single 0 or 1 byte
+//	byte strings and strings      4-byte big-endian length, then the bytes
+//	lists                         4-byte big-endian count, then the elements
+//
+// Every value has exactly one encoding, and decoding rejects anything
+// else, trailing bytes included, so that hashes computed over encoded
+// values don't depend on the implementation.
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var (
+	ErrTruncated = errors.New("wire: truncated input")
+	ErrTrailing  = errors.New("wire: trailing bytes")
+	ErrBool      = errors.New("wire: invalid boolean")
+	ErrTooLong   = errors.New("wire: value too long")
+)
+
+// Encoder accumulates the encoding of a sequence of values
+type Encoder struct {
+	buf bytes.Buffer
+}
+
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+func (e *Encoder) PutUint8(v uint8) {
+	e.buf.WriteByte(v)
+}
+
+func (e *Encoder) PutUint32(v uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	e.buf.Write(b[:])
+}
+
+func (e *Encoder) PutUint64(v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	e.buf.Write(b[:])
+}
+
+// PutInt64 writes the two's complement of v
+func (e *Encoder) PutInt64(v int64) {
+	e.PutUint64(uint64(v))
+}
+
+func (e *Encoder) PutBool(v bool) {
+	if v {
+		e.PutUint8(1)
+	} else {
+		e.PutUint8(0)
+	}
+}
+
+// PutCount writes the number of elements of a list
+func (e *Encoder) PutCount(n int) {
+	e.PutUint32(uint32(n))
+}
+
+func (e *Encoder) PutBytes(b []byte) {
+	e.PutCount(len(b))
+	e.buf.Write(b)
+}
+
+func (e *Encoder) PutString(s string) {
+	e.PutCount(len(s))
+	e.buf.WriteString(s)
+}
+
+// Bytes returns the encoding of the values written so far
+func (e *Encoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// Decoder reads a sequence of values. Once a value can't be decoded, the
+// following ones are zero values and Err (as well as Finish) returns the
+// first error.
+type Decoder struct {
+	b   []byte
+	err error
+}
+
+func NewDecoder(b []byte) *Decoder {
+	return &Decoder{b: b}
+}
+
+func (d *Decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n > len(d.b) {
+		d.err = ErrTruncated
+		return nil
+	}
+	b := d.b[0:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *Decoder) Uint8() uint8 {
+	if b := d.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *Decoder) Uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *Decoder) Uint64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *Decoder) Int64() int64 {
+	return int64(d.Uint64())
+}
+
+func (d *Decoder) Bool() bool {
+	switch d.Uint8() {
+	case 0:
+		return false
+	case 1:
+		return true
+	}
+	if d.err == nil {
+		d.err = ErrBool
+	}
+	return false
+}
+
+// Count reads the number of elements of a list. As every element takes
+// at least a byte, counts exceeding the remaining input are rejected.
+func (d *Decoder) Count() int {
+	n := d.Uint32()
+	if d.err == nil && (uint64(n) > uint64(len(d.b)) || uint64(n) > math.MaxInt32) {
+		d.err = ErrTooLong
+		return 0
+	}
+	return int(n)
+}
+
+// Bytes reads a byte string, returning nil for empty ones
+func (d *Decoder) Bytes() []byte {
+	n := d.Count()
+	if n == 0 {
+		return nil
+	}
+	return append([]byte{}, d.next(n)...)
+}
+
+func (d *Decoder) String() string {
+	return string(d.next(d.Count()))
+}
+
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Finish returns the first decoding error, if any, or an error if the
+// input hasn't been entirely read
+func (d *Decoder) Finish() error {
+	if d.err == nil && len(d.b) > 0 {
+		d.err = ErrTrailing
+	}
+	return d.err
+}
@@ -0,0 +1,58 @@
+package wire
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncoder(t *testing.T) {
+	enc := NewEncoder()
+	enc.PutUint8(7)
+	enc.PutUint32(0x01020304)
+	enc.PutInt64(-2)
+	enc.PutBool(true)
+	enc.PutBool(false)
+	enc.PutBytes([]byte{0xab, 0xcd})
+	enc.PutBytes(nil)
+	enc.PutString("ref")
+	enc.PutCount(2)
+	assert.Equal(t, hex.EncodeToString(enc.Bytes()),
+		"07"+"01020304"+"fffffffffffffffe"+"01"+"00"+"00000002abcd"+"00000000"+"00000003726566"+"00000002")
+}
+
+func TestDecoder(t *testing.T) {
+	b, _ := hex.DecodeString("07" + "01020304" + "fffffffffffffffe" + "01" + "00" + "00000002abcd" + "00000000" + "00000003726566")
+	dec := NewDecoder(b)
+	assert.Equal(t, dec.Uint8(), uint8(7))
+	assert.Equal(t, dec.Uint32(), uint32(0x01020304))
+	assert.Equal(t, dec.Int64(), int64(-2))
+	assert.True(t, dec.Bool())
+	assert.False(t, dec.Bool())
+	assert.Equal(t, dec.Bytes(), []byte{0xab, 0xcd})
+	assert.Nil(t, dec.Bytes())
+	assert.Equal(t, dec.String(), "ref")
+	assert.Nil(t, dec.Finish())
+}
+
+func TestDecoderErrors(t *testing.T) {
+	dec := NewDecoder([]byte{0, 0, 1})
+	dec.Uint32()
+	assert.Equal(t, dec.Err(), ErrTruncated)
+	// errors stick
+	assert.Equal(t, dec.Uint8(), uint8(0))
+	assert.Equal(t, dec.Finish(), ErrTruncated)
+
+	dec = NewDecoder([]byte{2})
+	dec.Bool()
+	assert.Equal(t, dec.Finish(), ErrBool)
+
+	dec = NewDecoder([]byte{0, 0, 0, 3, 'a', 'b'})
+	assert.Equal(t, dec.String(), "")
+	assert.Equal(t, dec.Finish(), ErrTooLong)
+
+	dec = NewDecoder([]byte{1, 2})
+	dec.Uint8()
+	assert.Equal(t, dec.Finish(), ErrTrailing)
+}